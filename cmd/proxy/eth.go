@@ -16,6 +16,24 @@ func (cmd ethProxyCmd) toOptions() []proxy.Option {
 		proxy.Address(cmd.Address),
 		proxy.NetworkId(cmd.NetworkId),
 		proxy.ChainId(cmd.ChainId),
+		proxy.MaxBatchSize(cmd.MaxBatchSize),
+		proxy.BroadcastFanOut(cmd.BroadcastFanOut),
+		proxy.GetLogsChunkSize(cmd.GetLogsChunkSize),
+		proxy.GetLogsParallelism(cmd.GetLogsParallelism),
+		proxy.FilterTimeout(cmd.FilterTimeout),
+		proxy.ResponseCacheTTL(cmd.ResponseCacheTTL),
+		proxy.ConfirmationDepth(cmd.ConfirmationDepth),
+		proxy.MaxRetries(cmd.MaxRetries),
+		proxy.RetryableErrors(cmd.RetryableErrors),
+		proxy.HedgePercentile(cmd.HedgePercentile),
+		proxy.HedgeMaxLoad(cmd.HedgeMaxLoad),
+		proxy.BreakerFailureThreshold(cmd.BreakerFailureThreshold),
+		proxy.BreakerOpenTimeout(cmd.BreakerOpenTimeout),
+		proxy.ForkChoice(cmd.ForkChoice),
+		proxy.TracingEndpoint(cmd.TracingEndpoint),
+		proxy.MaxHeadAge(cmd.MaxHeadAge),
+		proxy.AdminToken(cmd.AdminToken),
+		proxy.ApiKeysRequired(cmd.ApiKeysRequired),
 		proxy.NatsUrl(cmd.Nats.URL),
 		proxy.NatsEmbedded(cmd.Nats.Embedded.Enable),
 		proxy.NatsEmbeddedConfigPath(cmd.Nats.Embedded.ConfigPath),
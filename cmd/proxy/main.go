@@ -2,16 +2,35 @@ package main
 
 import (
 	"net/url"
+	"time"
 
 	"github.com/alecthomas/kong"
 	log "github.com/sirupsen/logrus"
 )
 
 type proxyCmd struct {
-	Address   string `name:"" env:"PROXY_SERVER_ADDRESS" default:":8080" help:"Address to bind the websocket server to."`
-	NetworkId uint64 `name:"" env:"ETH_NETWORK_ID" default:"1" help:"Ethereum network id."`
-	ChainId   uint64 `name:"" env:"ETH_CHAIN_ID" default:"1" help:"Ethereum chain id."`
-	Nats      struct {
+	Address                 string        `name:"" env:"PROXY_SERVER_ADDRESS" default:":8080" help:"Address to bind the http and websocket server to."`
+	NetworkId               uint64        `name:"" env:"ETH_NETWORK_ID" default:"1" help:"Ethereum network id."`
+	ChainId                 uint64        `name:"" env:"ETH_CHAIN_ID" default:"1" help:"Ethereum chain id."`
+	MaxBatchSize            int           `name:"" env:"PROXY_MAX_BATCH_SIZE" default:"100" help:"Max number of requests in a JSON-RPC batch, 0 for no limit."`
+	BroadcastFanOut         int           `name:"" env:"PROXY_BROADCAST_FAN_OUT" default:"0" help:"Number of healthy clients a raw transaction is broadcast to, 0 for all."`
+	GetLogsChunkSize        int           `name:"" env:"PROXY_GET_LOGS_CHUNK_SIZE" default:"2000" help:"Number of blocks per chunk when splitting eth_getLogs ranges across clients."`
+	GetLogsParallelism      int           `name:"" env:"PROXY_GET_LOGS_PARALLELISM" default:"4" help:"Number of eth_getLogs chunks requested concurrently."`
+	FilterTimeout           time.Duration `name:"" env:"PROXY_FILTER_TIMEOUT" default:"5m" help:"How long an installed filter is retained without being polled."`
+	ResponseCacheTTL        time.Duration `name:"" env:"PROXY_RESPONSE_CACHE_TTL" default:"24h" help:"Maximum time a response is retained in the shared store, methods may cache responses for less."`
+	ConfirmationDepth       int           `name:"" env:"PROXY_CONFIRMATION_DEPTH" default:"12" help:"Number of blocks below the head after which responses are cached in the shared store."`
+	MaxRetries              int           `name:"" env:"PROXY_MAX_RETRIES" default:"2" help:"Number of other clients a request is sent to after a retryable failure."`
+	RetryableErrors         []string      `name:"" env:"PROXY_RETRYABLE_ERRORS" default:"header not found,missing trie node,unknown block,block not found,required historical state unavailable" help:"JSON-RPC error messages which cause a request to be retried with another client."`
+	HedgePercentile         float64       `name:"" env:"PROXY_HEDGE_PERCENTILE" default:"0.95" help:"Latency percentile after which a slow request is hedged with a second copy sent to another client."`
+	HedgeMaxLoad            float64       `name:"" env:"PROXY_HEDGE_MAX_LOAD" default:"0.1" help:"Max hedged requests as a fraction of hedgeable requests, 0 to disable hedging."`
+	BreakerFailureThreshold int           `name:"" env:"PROXY_BREAKER_FAILURE_THRESHOLD" default:"5" help:"Consecutive failures after which a client is temporarily removed from routing, 0 to disable."`
+	BreakerOpenTimeout      time.Duration `name:"" env:"PROXY_BREAKER_OPEN_TIMEOUT" default:"10s" help:"How long a failing client is removed from routing before it is probed."`
+	ForkChoice              string        `name:"" env:"ETH_FORK_CHOICE" enum:"auto,total-difficulty,highest-number,most-clients,checkpoint" default:"auto" help:"Strategy for selecting the canonical head, use total-difficulty for PoW test chains."`
+	TracingEndpoint         string        `name:"" env:"PROXY_TRACING_ENDPOINT" help:"OTLP http endpoint to export traces to, e.g. localhost:4318, empty to disable."`
+	MaxHeadAge              time.Duration `name:"" env:"PROXY_MAX_HEAD_AGE" default:"1m" help:"How long the canonical head can go without changing before the proxy reports it is not ready."`
+	AdminToken              string        `name:"" env:"PROXY_ADMIN_TOKEN" help:"Bearer token granting access to the tethys_* admin methods, empty to disable them."`
+	ApiKeysRequired         bool          `name:"" env:"PROXY_API_KEYS_REQUIRED" help:"Reject requests which do not provide an api key in the X-Api-Key header, the apiKey query parameter or the /key/<key> url path."`
+	Nats                    struct {
 		URL      *url.URL `name:"" env:"URL" default:"ns://127.0.0.1:4222" help:"NATS server url."`
 		Embedded struct {
 			Enable     bool   `name:"" env:"ENABLE" default:"0" required:"" help:"Starts the proxy with an embedded NATS server."`
@@ -17,7 +17,10 @@ func (cmd *ethSidecarCmd) toOptions() []sidecar.Option {
 	result := []sidecar.Option{
 		sidecar.ClientUrl(cmd.ClientUrl),
 		sidecar.NatsUrl(cmd.NatsUrl),
+		sidecar.MetricsAddress(cmd.MetricsAddress),
+		sidecar.TracingEndpoint(cmd.TracingEndpoint),
 		sidecar.ClientConnectionType(eth.ToConnectionType(cmd.ClientConnectionType)),
+		sidecar.ClientSyncMode(cmd.ClientSyncMode),
 	}
 
 	if cmd.ClientConnectionType == eth.ConnectionType(eth.ConnectionTypeManaged).String() {
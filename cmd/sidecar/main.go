@@ -8,9 +8,12 @@ import (
 type sidecarCmd struct {
 	ClientUrl            string `name:"client-url" env:"WEB3_URL" default:"ws://127.0.0.1:8546" help:"Websocket url for connecting to a eth client"`
 	ClientConnectionType string `name:"client-connection-type" env:"WEB3_CONNECTION_TYPE" default:"ConnectionTypeDirect" help:"Indicates how the sidecar is connecting to the web3 client"`
+	ClientSyncMode       string `name:"client-sync-mode" env:"WEB3_SYNC_MODE" enum:"archive,full,snap" default:"full" help:"Indicates how much history the web3 client retains"`
 	// todo make client id required only if connection type is managed
-	ClientId string `name:"client-id" env:"WEB3_CLIENT_ID" help:"Allows for manually specifying the client id when the connection type is managed."`
-	NatsUrl  string `name:"nats-url" env:"NATS_URL" default:"ns://127.0.0.1:4222" help:"NATS server url"`
+	ClientId        string `name:"client-id" env:"WEB3_CLIENT_ID" help:"Allows for manually specifying the client id when the connection type is managed."`
+	NatsUrl         string `name:"nats-url" env:"NATS_URL" default:"ns://127.0.0.1:4222" help:"NATS server url"`
+	MetricsAddress  string `name:"metrics-address" env:"METRICS_ADDRESS" default:":8081" help:"Address to serve prometheus metrics and health endpoints on, empty to disable"`
+	TracingEndpoint string `name:"tracing-endpoint" env:"TRACING_ENDPOINT" help:"OTLP http endpoint to export traces to, e.g. localhost:4318, empty to disable"`
 }
 
 var cli struct {
@@ -1,6 +1,7 @@
 package nats
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -21,6 +22,15 @@ func Create(create bool) Option {
 	}
 }
 
+// ProxyStores opens the stores which are only used by the proxy: transactions, filters and api keys. Other
+// components leave them disabled so they do not depend on the proxy having created the buckets.
+func ProxyStores(enabled bool) Option {
+	return func(opts *Options) error {
+		opts.ProxyStores = enabled
+		return nil
+	}
+}
+
 func NetworkAndChainId(networkId uint64, chainId uint64) Option {
 	return func(opts *Options) error {
 		opts.NetworkId = networkId
@@ -43,6 +53,23 @@ func BucketStatusesFormat(name string) Option {
 	}
 }
 
+// BucketResponsesTTL is the maximum time a cached response is retained, entries may expire sooner according
+// to the cache policy of the method.
+func BucketResponsesTTL(ttl time.Duration) Option {
+	return func(opts *Options) error {
+		opts.BucketConfigResponses.TTL = ttl
+		return nil
+	}
+}
+
+// BucketFiltersTTL is how long an installed filter is retained without being polled.
+func BucketFiltersTTL(ttl time.Duration) Option {
+	return func(opts *Options) error {
+		opts.BucketConfigFilters.TTL = ttl
+		return nil
+	}
+}
+
 func BucketProfilesFormat(name string) Option {
 	return func(opts *Options) error {
 		opts.BucketConfigProfiles.Format = name
@@ -59,21 +86,34 @@ type bucketConfigProfiles struct {
 	Format string
 }
 
+type bucketConfigResponses struct {
+	TTL time.Duration
+}
+
+type bucketConfigFilters struct {
+	TTL time.Duration
+}
+
 type Options struct {
 	Create bool
 
+	ProxyStores bool
+
 	NetworkId uint64
 	ChainId   uint64
 
-	BucketConfigStatuses bucketConfigStatuses
-	BucketConfigProfiles bucketConfigProfiles
+	BucketConfigStatuses  bucketConfigStatuses
+	BucketConfigProfiles  bucketConfigProfiles
+	BucketConfigResponses bucketConfigResponses
+	BucketConfigFilters   bucketConfigFilters
 }
 
 func GetDefaultOptions() Options {
 	return Options{
-		Create:    false,
-		NetworkId: 1,
-		ChainId:   1,
+		Create:      false,
+		ProxyStores: false,
+		NetworkId:   1,
+		ChainId:     1,
 
 		BucketConfigStatuses: bucketConfigStatuses{
 			Format:  "eth_%d_%d_client_statuses",
@@ -83,6 +123,14 @@ func GetDefaultOptions() Options {
 		BucketConfigProfiles: bucketConfigProfiles{
 			Format: "eth_%d_%d_client_profiles",
 		},
+
+		BucketConfigResponses: bucketConfigResponses{
+			TTL: 24 * time.Hour,
+		},
+
+		BucketConfigFilters: bucketConfigFilters{
+			TTL: 5 * time.Minute,
+		},
 	}
 }
 
@@ -92,11 +140,25 @@ type ProfileStore = natsutil.KeyValue[eth.ClientProfile]
 
 type ResponseStore = natsutil.KeyValue[jsonrpc.Response]
 
+type TransactionStore = natsutil.KeyValue[eth.TransactionBroadcast]
+
+type FilterStore = natsutil.KeyValue[eth.Filter]
+
+type ApiKeyStore = natsutil.KeyValue[eth.ApiKey]
+
+type LogChunkStore = natsutil.KeyValue[[]json.RawMessage]
+
 type StateManager struct {
 	Opts      Options
 	Status    StatusStore
 	Profiles  ProfileStore
 	Responses ResponseStore
+
+	// only opened with the ProxyStores option
+	Transactions TransactionStore
+	Filters      FilterStore
+	ApiKeys      ApiKeyStore
+	LogChunks    LogChunkStore
 }
 
 func NewStateManager(js nats.JetStreamContext, options ...Option) (*StateManager, error) {
@@ -122,12 +184,34 @@ func NewStateManager(js nats.JetStreamContext, options ...Option) (*StateManager
 		return nil, errors.Annotate(err, "failed to init response store")
 	}
 
-	return &StateManager{
+	stateManager := &StateManager{
 		Opts:      opts,
 		Status:    statusStore,
 		Profiles:  profileStore,
 		Responses: responseStore,
-	}, nil
+	}
+
+	if !opts.ProxyStores {
+		return stateManager, nil
+	}
+
+	if stateManager.Transactions, err = initTransactionStore(js, opts); err != nil {
+		return nil, errors.Annotate(err, "failed to init transaction store")
+	}
+
+	if stateManager.Filters, err = initFilterStore(js, opts); err != nil {
+		return nil, errors.Annotate(err, "failed to init filter store")
+	}
+
+	if stateManager.ApiKeys, err = initApiKeyStore(js, opts); err != nil {
+		return nil, errors.Annotate(err, "failed to init api key store")
+	}
+
+	if stateManager.LogChunks, err = initLogChunkStore(js, opts); err != nil {
+		return nil, errors.Annotate(err, "failed to init log chunk store")
+	}
+
+	return stateManager, nil
 }
 
 func initStatusStore(js nats.JetStreamContext, opts Options) (StatusStore, error) {
@@ -163,9 +247,89 @@ func initResponseStore(js nats.JetStreamContext, opts Options) (ResponseStore, e
 		return natsutil.GetKeyValue[jsonrpc.Response](js, bucket)
 	}
 
-	return natsutil.CreateKeyValue[jsonrpc.Response](js, &nats.KeyValueConfig{
+	return createKeyValueWithTTL[jsonrpc.Response](js, bucket, opts.BucketConfigResponses.TTL)
+}
+
+// createKeyValueWithTTL creates a bucket whose entries expire after the ttl. Creating a bucket which exists with a
+// different TTL fails, so the TTL of an existing bucket is updated instead.
+func createKeyValueWithTTL[T any](js nats.JetStreamContext, bucket string, ttl time.Duration) (natsutil.KeyValue[T], error) {
+	if _, err := js.KeyValue(bucket); err == nil {
+		if err := updateBucketTTL(js, bucket, ttl); err != nil {
+			return nil, err
+		}
+		return natsutil.GetKeyValue[T](js, bucket)
+	} else if err != nats.ErrBucketNotFound {
+		return nil, errors.Annotatef(err, "failed to retrieve kv store with bucket = %s", bucket)
+	}
+
+	return natsutil.CreateKeyValue[T](js, &nats.KeyValueConfig{
+		Bucket: bucket,
+		TTL:    ttl,
+	})
+}
+
+func updateBucketTTL(js nats.JetStreamContext, bucket string, ttl time.Duration) error {
+	// kv buckets are backed by a stream of the same name with a KV_ prefix
+	info, err := js.StreamInfo("KV_" + bucket)
+	if err != nil {
+		return errors.Annotatef(err, "failed to retrieve stream info for bucket = %s", bucket)
+	}
+	if info.Config.MaxAge == ttl {
+		return nil
+	}
+
+	config := info.Config
+	config.MaxAge = ttl
+	if _, err = js.UpdateStream(&config); err != nil {
+		return errors.Annotatef(err, "failed to update TTL for bucket = %s", bucket)
+	}
+	return nil
+}
+
+func initTransactionStore(js nats.JetStreamContext, opts Options) (TransactionStore, error) {
+	bucket := fmt.Sprintf("eth_%d_%d_proxy_transactions", opts.NetworkId, opts.ChainId)
+
+	if !opts.Create {
+		return natsutil.GetKeyValue[eth.TransactionBroadcast](js, bucket)
+	}
+
+	return natsutil.CreateKeyValue[eth.TransactionBroadcast](js, &nats.KeyValueConfig{
 		Bucket: bucket,
 		// todo make configurable
-		TTL: 1 * time.Hour,
+		TTL: 24 * time.Hour,
 	})
 }
+
+func initFilterStore(js nats.JetStreamContext, opts Options) (FilterStore, error) {
+	bucket := fmt.Sprintf("eth_%d_%d_proxy_filters", opts.NetworkId, opts.ChainId)
+
+	if !opts.Create {
+		return natsutil.GetKeyValue[eth.Filter](js, bucket)
+	}
+
+	// filters are re-written each time they are polled so idle filters expire
+	return createKeyValueWithTTL[eth.Filter](js, bucket, opts.BucketConfigFilters.TTL)
+}
+
+func initApiKeyStore(js nats.JetStreamContext, opts Options) (ApiKeyStore, error) {
+	bucket := fmt.Sprintf("eth_%d_%d_proxy_api_keys", opts.NetworkId, opts.ChainId)
+
+	if !opts.Create {
+		return natsutil.GetKeyValue[eth.ApiKey](js, bucket)
+	}
+
+	return natsutil.CreateKeyValue[eth.ApiKey](js, &nats.KeyValueConfig{
+		Bucket: bucket,
+	})
+}
+
+func initLogChunkStore(js nats.JetStreamContext, opts Options) (LogChunkStore, error) {
+	bucket := fmt.Sprintf("eth_%d_%d_proxy_log_chunks", opts.NetworkId, opts.ChainId)
+
+	if !opts.Create {
+		return natsutil.GetKeyValue[[]json.RawMessage](js, bucket)
+	}
+
+	// finalized logs never change, the TTL of the responses only bounds how much is retained
+	return createKeyValueWithTTL[[]json.RawMessage](js, bucket, opts.BucketConfigResponses.TTL)
+}
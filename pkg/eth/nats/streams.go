@@ -0,0 +1,101 @@
+package nats
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+)
+
+// NewHeadsSubject returns the subject a client publishes its new heads on.
+func NewHeadsSubject(networkId uint64, chainId uint64, clientName string, clientVersion string, clientId string) string {
+	return natsutil.SubjectName(
+		"eth", "newHeads",
+		strconv.FormatUint(networkId, 10),
+		strconv.FormatUint(chainId, 10),
+		clientName, clientVersion, clientId,
+	)
+}
+
+// NewHeadsStreamConfig returns the JetStream config for the stream which captures the new heads of all
+// clients for a given network and chain.
+func NewHeadsStreamConfig(networkId uint64, chainId uint64) *nats.StreamConfig {
+	return &nats.StreamConfig{
+		Name:              fmt.Sprintf("eth_%d_%d_newHeads", networkId, chainId),
+		Description:       fmt.Sprintf("ETH newHeads for networkId %d and chainId %d", networkId, chainId),
+		Subjects:          []string{NewHeadsSubject(networkId, chainId, "*", "*", "*")},
+		MaxMsgsPerSubject: 128,
+	}
+}
+
+// LogsSubject returns the subject that logs for a given block hash are published on.
+func LogsSubject(networkId uint64, chainId uint64, blockHash string) string {
+	return natsutil.SubjectName(
+		"eth", "logs",
+		strconv.FormatUint(networkId, 10),
+		strconv.FormatUint(chainId, 10),
+		blockHash,
+	)
+}
+
+// LogsStreamConfig returns the JetStream config for the stream which captures the logs observed by all
+// clients for a given network and chain. Logs are keyed by block hash and de-duplicated across clients.
+func LogsStreamConfig(networkId uint64, chainId uint64) *nats.StreamConfig {
+	return &nats.StreamConfig{
+		Name:        fmt.Sprintf("eth_%d_%d_logs", networkId, chainId),
+		Description: fmt.Sprintf("ETH logs for networkId %d and chainId %d", networkId, chainId),
+		Subjects:    []string{LogsSubject(networkId, chainId, "*")},
+		MaxAge:      1 * time.Hour,
+		Duplicates:  5 * time.Minute,
+	}
+}
+
+// LogMsgId returns the JetStream message id used to de-duplicate a log published by multiple clients.
+func LogMsgId(blockHash string, logIndex string) string {
+	return fmt.Sprintf("%s:%s", blockHash, logIndex)
+}
+
+// ReorgsSubject returns the subject that re-org events are published on.
+func ReorgsSubject(networkId uint64, chainId uint64) string {
+	return natsutil.SubjectName(
+		"eth", "reorgs",
+		strconv.FormatUint(networkId, 10),
+		strconv.FormatUint(chainId, 10),
+	)
+}
+
+// ReorgsStreamConfig returns the JetStream config for the stream which captures re-org events for a given
+// network and chain.
+func ReorgsStreamConfig(networkId uint64, chainId uint64) *nats.StreamConfig {
+	return &nats.StreamConfig{
+		Name:        fmt.Sprintf("eth_%d_%d_reorgs", networkId, chainId),
+		Description: fmt.Sprintf("ETH re-orgs for networkId %d and chainId %d", networkId, chainId),
+		Subjects:    []string{ReorgsSubject(networkId, chainId)},
+		MaxAge:      7 * 24 * time.Hour,
+		Duplicates:  5 * time.Minute,
+	}
+}
+
+// ReorgMsgId returns the JetStream message id used to de-duplicate a re-org event published by multiple proxies.
+func ReorgMsgId(oldHead string, newHead string) string {
+	return fmt.Sprintf("%s:%s", oldHead, newHead)
+}
+
+// EnsureStream creates the stream if it does not already exist.
+func EnsureStream(js nats.JetStreamContext, config *nats.StreamConfig) error {
+	_, err := js.StreamInfo(config.Name)
+	if err == nil {
+		// already exists
+		return nil
+	}
+	if err != nats.ErrStreamNotFound {
+		return errors.Annotatef(err, "failed to retrieve stream info for stream = %s", config.Name)
+	}
+	if _, err = js.AddStream(config); err != nil {
+		return errors.Annotatef(err, "failed to create stream = %s", config.Name)
+	}
+	return nil
+}
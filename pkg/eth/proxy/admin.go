@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	"github.com/41north/tethys/pkg/eth"
+	natseth "github.com/41north/tethys/pkg/eth/nats"
+	proxymethods "github.com/41north/tethys/pkg/eth/proxy/methods"
+	"github.com/41north/tethys/pkg/eth/tracking"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+)
+
+type adminClient struct {
+	Profile eth.ClientProfile `json:"profile"`
+	Status  *eth.ClientStatus `json:"status,omitempty"`
+}
+
+type adminBlock struct {
+	Number     *hexutil.Big `json:"number"`
+	Hash       string       `json:"hash"`
+	ParentHash string       `json:"parentHash"`
+	Clients    int          `json:"clients"`
+}
+
+type adminBlockRef struct {
+	Number *hexutil.Big `json:"number"`
+	Hash   string       `json:"hash"`
+}
+
+type adminCanonicalChain struct {
+	Safe      *adminBlockRef `json:"safe,omitempty"`
+	Finalized *adminBlockRef `json:"finalized,omitempty"`
+	Blocks    []adminBlock   `json:"blocks"`
+}
+
+type adminRoutingTable struct {
+	PreferredConnectionType *eth.ConnectionType `json:"preferredConnectionType,omitempty"`
+	Clients                 map[string][]string `json:"clients"`
+	Breakers                map[string]string   `json:"breakers"`
+}
+
+type adminCacheStats struct {
+	Responses  CacheStats      `json:"responses"`
+	Coalescing CoalescingStats `json:"coalescing"`
+}
+
+// AdminRouter answers the tethys methods from the internal state of the proxy rather than routing them to a
+// client.
+type AdminRouter struct {
+	stateManager      *natseth.StateManager
+	chain             *tracking.CanonicalChain
+	latestBlockRouter *LatestBlockRouter
+	cachingRouter     *BlockCachingRouter
+	coalescingRouter  *CoalescingRouter
+}
+
+func NewAdminRouter(
+	stateManager *natseth.StateManager,
+	chain *tracking.CanonicalChain,
+	latestBlockRouter *LatestBlockRouter,
+	cachingRouter *BlockCachingRouter,
+	coalescingRouter *CoalescingRouter,
+) natsutil.Router {
+	return &AdminRouter{
+		stateManager:      stateManager,
+		chain:             chain,
+		latestBlockRouter: latestBlockRouter,
+		cachingRouter:     cachingRouter,
+		coalescingRouter:  coalescingRouter,
+	}
+}
+
+func (r *AdminRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...natsutil.RouteOpt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.RequestWithContext(ctx, req, resp, options...)
+}
+
+func (r *AdminRouter) RequestWithContext(_ context.Context, req jsonrpc.Request, resp *jsonrpc.Response, _ ...natsutil.RouteOpt) error {
+	var result any
+	var err error
+
+	switch req.Method {
+	case proxymethods.TethysClients:
+		result, err = r.clients()
+	case proxymethods.TethysCanonicalChain:
+		result = r.canonicalChain()
+	case proxymethods.TethysRoutingTable:
+		result = r.routingTable()
+	case proxymethods.TethysCacheStats:
+		result = adminCacheStats{
+			Responses:  r.cachingRouter.Stats(),
+			Coalescing: r.coalescingRouter.Stats(),
+		}
+	default:
+		return errors.Errorf("unsupported admin method: %s", req.Method)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	resp.Result, err = json.Marshal(result)
+	return err
+}
+
+func (r *AdminRouter) clients() ([]adminClient, error) {
+	result := []adminClient{}
+
+	ids, err := r.stateManager.Profiles.Delegate().Keys()
+	if err == nats.ErrNoKeysFound {
+		return result, nil
+	} else if err != nil {
+		return nil, errors.Annotate(err, "failed to list client profiles")
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		client, err := r.client(id)
+		if err == nats.ErrKeyNotFound {
+			// removed since the keys were listed
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result = append(result, *client)
+	}
+
+	return result, nil
+}
+
+func (r *AdminRouter) client(id string) (*adminClient, error) {
+	profileEntry, err := r.stateManager.Profiles.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := profileEntry.Value()
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to unmarshal client profile: %s", id)
+	}
+
+	client := adminClient{Profile: profile}
+
+	statusEntry, err := r.stateManager.Status.Get(id)
+	if err == nats.ErrKeyNotFound {
+		// the client is not currently connected
+		return &client, nil
+	} else if err != nil {
+		return nil, err
+	}
+	status, err := statusEntry.Value()
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to unmarshal client status: %s", id)
+	}
+	client.Status = &status
+
+	return &client, nil
+}
+
+func (r *AdminRouter) canonicalChain() adminCanonicalChain {
+	result := adminCanonicalChain{
+		Safe:      toAdminBlockRef(r.chain.Safe()),
+		Finalized: toAdminBlockRef(r.chain.Finalized()),
+		Blocks:    []adminBlock{},
+	}
+
+	for _, block := range r.chain.Blocks() {
+		result.Blocks = append(result.Blocks, adminBlock{
+			Number:     (*hexutil.Big)(block.Number),
+			Hash:       block.BlockHash,
+			ParentHash: block.ParentHash,
+			Clients:    len(r.chain.ClientIds(block)),
+		})
+	}
+
+	return result
+}
+
+func (r *AdminRouter) routingTable() adminRoutingTable {
+	preferred, clientsByConnection := r.latestBlockRouter.RoutingTable()
+
+	result := adminRoutingTable{
+		Clients:  make(map[string][]string),
+		Breakers: make(map[string]string),
+	}
+
+	if len(clientsByConnection) > 0 {
+		result.PreferredConnectionType = &preferred
+	}
+	for connectionType, clientIds := range clientsByConnection {
+		result.Clients[connectionType.String()] = clientIds
+	}
+	for clientId, state := range r.latestBlockRouter.BreakerStates() {
+		result.Breakers[clientId] = state.String()
+	}
+
+	return result
+}
+
+func toAdminBlockRef(ref *tracking.BlockRef) *adminBlockRef {
+	if ref == nil {
+		return nil
+	}
+	return &adminBlockRef{Number: (*hexutil.Big)(ref.Number), Hash: ref.BlockHash}
+}
@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	"github.com/41north/tethys/pkg/eth"
+	natseth "github.com/41north/tethys/pkg/eth/nats"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ApiKeyHeader is the http header an api key can be provided in.
+	ApiKeyHeader = "X-Api-Key"
+	// ApiKeyQueryParam is the query string parameter an api key can be provided in.
+	ApiKeyQueryParam = "apiKey"
+	// ApiKeyPathPrefix is the url path an api key can be appended to, e.g. /key/<key>.
+	ApiKeyPathPrefix = "/key/"
+)
+
+// HashApiKey returns the id an api key is stored against in the api key bucket.
+func HashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// apiKeyFromRequest extracts an api key from the header, the query string or the url path, in that order. Other
+// paths are not treated as keys so that existing callers using arbitrary paths remain anonymous.
+func apiKeyFromRequest(request *http.Request) string {
+	if key := request.Header.Get(ApiKeyHeader); key != "" {
+		return key
+	}
+	if key := request.URL.Query().Get(ApiKeyQueryParam); key != "" {
+		return key
+	}
+	if strings.HasPrefix(request.URL.Path, ApiKeyPathPrefix) {
+		return strings.Trim(strings.TrimPrefix(request.URL.Path, ApiKeyPathPrefix), "/")
+	}
+	return ""
+}
+
+// rateLimiter is a token bucket which refills at a sustained rate up to a burst.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	// a burst below one would never allow a request
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (l *rateLimiter) allow() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+type apiKeyEntry struct {
+	key     eth.ApiKey
+	methods map[string]bool
+	limiter *rateLimiter
+}
+
+func newApiKeyEntry(key eth.ApiKey, previous *apiKeyEntry) *apiKeyEntry {
+	entry := &apiKeyEntry{key: key}
+
+	if len(key.Methods) > 0 {
+		entry.methods = make(map[string]bool, len(key.Methods))
+		for _, method := range key.Methods {
+			entry.methods[method] = true
+		}
+	}
+
+	if key.RequestsPerSecond > 0 {
+		// keep the tokens already consumed unless the quota has changed
+		if previous != nil && previous.limiter != nil &&
+			previous.key.RequestsPerSecond == key.RequestsPerSecond && previous.key.Burst == key.Burst {
+			entry.limiter = previous.limiter
+		} else {
+			entry.limiter = newRateLimiter(key.RequestsPerSecond, key.Burst)
+		}
+	}
+
+	return entry
+}
+
+// ApiKeys holds the api keys from the api key bucket in memory, watching the bucket so that changes made by
+// an operator are applied to every proxy instance.
+type ApiKeys struct {
+	watcher nats.KeyWatcher
+	entries map[string]*apiKeyEntry
+	mutex   sync.RWMutex
+	log     *log.Entry
+}
+
+func NewApiKeys(store natseth.ApiKeyStore) (*ApiKeys, error) {
+	watcher, err := store.Delegate().WatchAll()
+	if err != nil {
+		return nil, errors.Annotate(err, "failed to create api key watcher")
+	}
+
+	k := &ApiKeys{
+		watcher: watcher,
+		entries: make(map[string]*apiKeyEntry),
+		log:     log.WithField("component", "ApiKeys"),
+	}
+
+	// the watcher sends a nil entry once the existing keys have been delivered, wait for it so that requests
+	// are not rejected whilst the keys are loading
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+		k.apply(entry)
+	}
+
+	go func() {
+		for entry := range watcher.Updates() {
+			if entry != nil {
+				k.apply(entry)
+			}
+		}
+	}()
+
+	return k, nil
+}
+
+func (k *ApiKeys) apply(entry nats.KeyValueEntry) {
+	id := entry.Key()
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if entry.Operation() != nats.KeyValuePut {
+		delete(k.entries, id)
+		return
+	}
+
+	var key eth.ApiKey
+	if err := json.Unmarshal(entry.Value(), &key); err != nil {
+		// reject the key rather than continuing with a previous definition
+		delete(k.entries, id)
+		k.log.WithError(err).WithField("id", id).Error("failed to unmarshal api key")
+		return
+	}
+
+	k.entries[id] = newApiKeyEntry(key, k.entries[id])
+}
+
+func (k *ApiKeys) get(id string) (*apiKeyEntry, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	entry, ok := k.entries[id]
+	if !ok || entry.key.Disabled {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Close stops watching the api key bucket.
+func (k *ApiKeys) Close() {
+	if err := k.watcher.Stop(); err != nil {
+		k.log.WithError(err).Warn("failed to stop api key watcher")
+	}
+}
+
+// authenticate determines the id of the api key provided with a request, returning an empty id for anonymous
+// requests when keys are not required. A key which is provided must always be valid.
+func (k *ApiKeys) authenticate(request *http.Request, required bool) (string, *jsonrpc.Error) {
+	key := apiKeyFromRequest(request)
+	if key == "" {
+		if required {
+			rejectedRequestsTotal.WithLabelValues("api_key_required").Inc()
+			return "", &errApiKeyRequired
+		}
+		return "", nil
+	}
+
+	id := HashApiKey(key)
+	if _, ok := k.get(id); !ok {
+		rejectedRequestsTotal.WithLabelValues("invalid_api_key").Inc()
+		return "", &errInvalidApiKey
+	}
+
+	return id, nil
+}
+
+// authorize wraps an invoker, checking each request against the methods and quota of the api key. The key
+// is looked up for every request so that changes apply to long-lived websocket connections.
+func (k *ApiKeys) authorize(id string, invoker invokeFn) invokeFn {
+	if id == "" {
+		return invoker
+	}
+
+	return func(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response) {
+		var rpcErr jsonrpc.Error
+		var reason string
+
+		entry, ok := k.get(id)
+		switch {
+		case !ok:
+			rpcErr, reason = errInvalidApiKey, "invalid_api_key"
+		case entry.methods != nil && !entry.methods[req.Method]:
+			rpcErr, reason = errMethodNotAllowed, "method_not_allowed"
+		case entry.limiter != nil && !entry.limiter.allow():
+			rpcErr, reason = errRateLimited, "rate_limited"
+		default:
+			apiKeyRequestsTotal.WithLabelValues(entry.key.Name).Inc()
+			invoker(ctx, req, resp)
+			return
+		}
+
+		rejectedRequestsTotal.WithLabelValues(reason).Inc()
+
+		resp.Id = req.Id
+		resp.Version = "2.0"
+		resp.Error = &rpcErr
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/41north/go-jsonrpc"
+)
+
+// invokeFn invokes a single request, populating the response.
+type invokeFn = func(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response)
+
+// handlePayload parses and invokes a single request or a batch of requests, returning either a single
+// response or an array of responses accordingly.
+func handlePayload(ctx context.Context, payload []byte, maxBatchSize int, invoker invokeFn) any {
+	requests, batch, err := parseRequests(payload)
+	if err != nil {
+		return &jsonrpc.Response{Version: "2.0", Error: &jsonrpc.ErrParse}
+	}
+
+	if !batch {
+		resp := &jsonrpc.Response{}
+		invoker(ctx, *requests[0], resp)
+		return resp
+	}
+
+	if errResp := validateBatch(requests, maxBatchSize); errResp != nil {
+		return errResp
+	}
+
+	return invokeBatch(ctx, requests, invoker)
+}
+
+// parseRequests unmarshals a payload which can contain either a single request or a batch of requests.
+// Batch entries which cannot be unmarshalled are returned as nil so that an error response can be
+// generated for them whilst preserving the order of the batch.
+func parseRequests(payload []byte) (requests []*jsonrpc.Request, batch bool, err error) {
+	payload = bytes.TrimLeft(payload, " \t\r\n")
+
+	if len(payload) == 0 || payload[0] != '[' {
+		var req jsonrpc.Request
+		if err = json.Unmarshal(payload, &req); err != nil {
+			return nil, false, err
+		}
+		return []*jsonrpc.Request{&req}, false, nil
+	}
+
+	var entries []json.RawMessage
+	if err = json.Unmarshal(payload, &entries); err != nil {
+		return nil, true, err
+	}
+
+	requests = make([]*jsonrpc.Request, len(entries))
+	for idx, entry := range entries {
+		var req jsonrpc.Request
+		if err := json.Unmarshal(entry, &req); err != nil {
+			continue
+		}
+		requests[idx] = &req
+	}
+
+	return requests, true, nil
+}
+
+// invokeBatch fans out each request in the batch concurrently and returns the responses in the same
+// order as the requests.
+func invokeBatch(ctx context.Context, requests []*jsonrpc.Request, invoker invokeFn) []*jsonrpc.Response {
+	responses := make([]*jsonrpc.Response, len(requests))
+
+	var wg sync.WaitGroup
+	wg.Add(len(requests))
+
+	for idx, req := range requests {
+		resp := &jsonrpc.Response{Version: "2.0"}
+		responses[idx] = resp
+
+		if req == nil {
+			resp.Error = &jsonrpc.ErrInvalidRequest
+			wg.Done()
+			continue
+		}
+
+		go func(req jsonrpc.Request) {
+			defer wg.Done()
+			invoker(ctx, req, resp)
+		}(*req)
+	}
+
+	wg.Wait()
+
+	return responses
+}
+
+// validateBatch returns an error response if the batch is empty or exceeds the max batch size.
+func validateBatch(requests []*jsonrpc.Request, maxBatchSize int) *jsonrpc.Response {
+	switch {
+	case len(requests) == 0:
+		return &jsonrpc.Response{Version: "2.0", Error: &jsonrpc.ErrInvalidRequest}
+	case maxBatchSize > 0 && len(requests) > maxBatchSize:
+		return &jsonrpc.Response{
+			Version: "2.0",
+			Error: &jsonrpc.Error{
+				Code:    jsonrpc.ErrInvalidRequest.Code,
+				Message: fmt.Sprintf("batch size exceeds the maximum of %d", maxBatchSize),
+			},
+		}
+	default:
+		return nil
+	}
+}
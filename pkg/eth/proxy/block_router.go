@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	"github.com/41north/tethys/pkg/eth"
+	natseth "github.com/41north/tethys/pkg/eth/nats"
+	"github.com/41north/tethys/pkg/eth/tracking"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	log "github.com/sirupsen/logrus"
+	"github.com/viney-shih/go-cache"
+)
+
+const (
+	// DefaultStateRetention is the number of blocks below the head for which full nodes retain state.
+	DefaultStateRetention = 128
+)
+
+// BlockRouter routes requests for historical blocks to clients which hold that block, and when required the
+// state for that block. Requests without a block param, or for blocks close to the head, are passed to the
+// delegate. Historical requests are sent through the client selection and retries of the delegate.
+type BlockRouter struct {
+	chain    *tracking.CanonicalChain
+	delegate *LatestBlockRouter
+
+	maxDistanceFromHead *big.Int
+	stateRetention      *big.Int
+
+	profileStore natseth.ProfileStore
+	profileCache cache.Cache
+
+	log *log.Entry
+}
+
+func NewBlockRouter(
+	chain *tracking.CanonicalChain,
+	delegate *LatestBlockRouter,
+	profileStore natseth.ProfileStore,
+	profileCache cache.Cache,
+	maxDistanceFromHead int,
+	stateRetention int,
+) *BlockRouter {
+	return &BlockRouter{
+		chain:               chain,
+		delegate:            delegate,
+		maxDistanceFromHead: big.NewInt(int64(maxDistanceFromHead)),
+		stateRetention:      big.NewInt(int64(stateRetention)),
+		profileStore:        profileStore,
+		profileCache:        profileCache,
+		log: log.WithFields(log.Fields{
+			"component":           "BlockRouter",
+			"maxDistanceFromHead": maxDistanceFromHead,
+			"stateRetention":      stateRetention,
+		}),
+	}
+}
+
+func (r *BlockRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...natsutil.RouteOpt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.RequestWithContext(ctx, req, resp, options...)
+}
+
+func (r *BlockRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, options ...natsutil.RouteOpt) error {
+	opts, err := natsutil.BuildRouteOpts(options...)
+	if err != nil {
+		return err
+	}
+
+	head := r.chain.Head()
+	ref, ok := blockParam(req, opts.BlockParamIdx)
+
+	if !ok || head == nil {
+		return r.delegate.RequestWithContext(ctx, req, resp, options...)
+	}
+
+	if ref.hash != "" {
+		if _, known := r.chain.BlockByHash(ref.hash); known {
+			// a recent block, the latest clients will have it
+			return r.delegate.RequestWithContext(ctx, req, resp, options...)
+		}
+		// an old or non-canonical block, we cannot tell which clients have it so an archive is the best bet
+		return r.requestFrom(ctx, req, resp, r.candidates(nil, nil, opts.RequiresState, true))
+	}
+
+	distance := new(big.Int).Sub(head.Number, ref.number)
+	if distance.Cmp(r.maxDistanceFromHead) <= 0 {
+		return r.delegate.RequestWithContext(ctx, req, resp, options...)
+	}
+
+	return r.requestFrom(ctx, req, resp, r.candidates(ref.number, distance, opts.RequiresState, false))
+}
+
+// requestRange sends a request covering a range of blocks, such as an eth_getLogs chunk, to a client which
+// holds the whole range.
+func (r *BlockRouter) requestRange(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, from *big.Int, to *big.Int) error {
+	head := r.chain.Head()
+	if head == nil || new(big.Int).Sub(head.Number, from).Cmp(r.maxDistanceFromHead) <= 0 {
+		// recent blocks, the latest clients will have them once they have reached the end of the range
+		return r.delegate.requestFrom(ctx, req, resp, func() []string {
+			return r.delegate.latestCandidates(func(clientId string) bool {
+				state, ok := r.chain.Client(clientId)
+				return ok && state.HasBlock(to)
+			})
+		})
+	}
+
+	return r.requestFrom(ctx, req, resp, r.candidates(to, nil, false, false))
+}
+
+// candidates returns the ids of clients which can serve a request for the block. When the block number is
+// unknown only archive clients are considered. Direct clients are preferred with managed providers as a fallback.
+func (r *BlockRouter) candidates(number *big.Int, distance *big.Int, requiresState bool, archiveOnly bool) []string {
+	candidatesByConnection := make(map[eth.ConnectionType][]string)
+
+	for _, state := range r.chain.Clients() {
+		if number != nil && !state.HasBlock(number) {
+			continue
+		}
+
+		profile, err := getClientProfile(r.profileStore, r.profileCache, state.Id)
+		if err != nil {
+			r.log.WithError(err).WithField("clientId", state.Id).Error("failed to load client profile")
+			continue
+		}
+
+		if profile.ConnectionType != eth.ConnectionTypeManaged && !r.canServe(profile, distance, requiresState, archiveOnly) {
+			continue
+		}
+
+		candidatesByConnection[profile.ConnectionType] = append(candidatesByConnection[profile.ConnectionType], state.Id)
+	}
+
+	for _, connectionType := range eth.ConnectionTypes {
+		if candidates := candidatesByConnection[connectionType]; len(candidates) > 0 {
+			return candidates
+		}
+	}
+
+	return nil
+}
+
+// canServe determines if the sync mode advertised by the client profile allows it to serve the request. Managed
+// providers do not advertise a sync mode and are assumed to be able to serve any request.
+func (r *BlockRouter) canServe(profile *eth.ClientProfile, distance *big.Int, requiresState bool, archiveOnly bool) bool {
+	switch profile.SyncMode {
+	case eth.SyncModeArchive:
+		return true
+	case eth.SyncModeFull:
+		if archiveOnly {
+			return false
+		}
+		return !requiresState || (distance != nil && distance.Cmp(r.stateRetention) <= 0)
+	default:
+		return false
+	}
+}
+
+func (r *BlockRouter) requestFrom(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, candidates []string) error {
+	return r.delegate.requestFrom(ctx, req, resp, func() []string { return candidates })
+}
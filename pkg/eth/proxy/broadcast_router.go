@@ -0,0 +1,280 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	"github.com/41north/tethys/pkg/eth"
+	natseth "github.com/41north/tethys/pkg/eth/nats"
+	"github.com/41north/tethys/pkg/eth/tracking"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"github.com/viney-shih/go-cache"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// DefaultBroadcastFanOut is the number of clients a transaction is sent to, 0 means all healthy clients.
+	DefaultBroadcastFanOut = 0
+
+	// broadcastTimeout bounds the time spent waiting on the slowest client once a broadcast has started.
+	broadcastTimeout = 10 * time.Second
+)
+
+// knownTransactionErrors are fragments of the error messages returned by the various clients when they
+// already have a transaction in their pool or chain.
+var knownTransactionErrors = []string{
+	"already known",       // geth, erigon
+	"known transaction",   // besu, older geth
+	"alreadyknown",        // nethermind
+	"transaction already", // openethereum
+}
+
+// BroadcastRouter sends a request to multiple healthy clients in parallel, returning the first successful
+// response. It is intended for eth_sendRawTransaction where we want a transaction to reach as much of the
+// network as possible. The clients which accepted the transaction are recorded in the transaction store.
+type BroadcastRouter struct {
+	conn  *nats.EncodedConn
+	chain *tracking.CanonicalChain
+
+	maxDistanceFromHead *big.Int
+	fanOut              int
+
+	subjectPrefix string
+	clientIdx     atomic.Uint64
+
+	profileStore     natseth.ProfileStore
+	profileCache     cache.Cache
+	transactionStore natseth.TransactionStore
+
+	breakers *CircuitBreakers
+
+	log *log.Entry
+}
+
+type broadcastResult struct {
+	clientId string
+	resp     *jsonrpc.Response
+	err      error
+}
+
+func NewBroadcastRouter(
+	conn *nats.EncodedConn,
+	chain *tracking.CanonicalChain,
+	profileStore natseth.ProfileStore,
+	profileCache cache.Cache,
+	transactionStore natseth.TransactionStore,
+	breakers *CircuitBreakers,
+	maxDistanceFromHead int,
+	fanOut int,
+) natsutil.Router {
+	return &BroadcastRouter{
+		conn:                conn,
+		chain:               chain,
+		maxDistanceFromHead: big.NewInt(int64(maxDistanceFromHead)),
+		fanOut:              fanOut,
+		subjectPrefix: natsutil.SubjectName(
+			"eth", "rpc",
+			strconv.FormatUint(chain.NetworkId, 10),
+			strconv.FormatUint(chain.ChainId, 10),
+		),
+		profileStore:     profileStore,
+		profileCache:     profileCache,
+		transactionStore: transactionStore,
+		breakers:         breakers,
+		log: log.WithFields(log.Fields{
+			"component":           "BroadcastRouter",
+			"maxDistanceFromHead": maxDistanceFromHead,
+			"fanOut":              fanOut,
+		}),
+	}
+}
+
+func (r *BroadcastRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...natsutil.RouteOpt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.RequestWithContext(ctx, req, resp, options...)
+}
+
+func (r *BroadcastRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, _ ...natsutil.RouteOpt) error {
+	clientIds := r.targets()
+	if len(clientIds) == 0 {
+		return natsutil.ErrNoClientsAvailable
+	}
+
+	hash, err := transactionHash(req)
+	if err != nil {
+		return errors.Annotate(err, "failed to determine transaction hash")
+	}
+
+	l := r.log.WithField("hash", hash)
+
+	// the broadcast is not bound to the request context, we want it to reach every client even after the
+	// caller has its answer
+	broadcastCtx, cancel := context.WithTimeout(context.Background(), broadcastTimeout)
+
+	results := make(chan broadcastResult, len(clientIds))
+	for _, clientId := range clientIds {
+		go func(clientId string) {
+			var clientResp jsonrpc.Response
+			err := natsutil.Request(broadcastCtx, r.conn, natsutil.SubjectName(r.subjectPrefix, clientId), req, &clientResp)
+			results <- broadcastResult{clientId: clientId, resp: &clientResp, err: err}
+		}(clientId)
+	}
+
+	accepted := make(chan *jsonrpc.Response, 1)
+	failed := make(chan broadcastResult, 1)
+
+	go func() {
+		defer cancel()
+
+		var acceptedBy []string
+		var firstFailure *broadcastResult
+
+		for i := 0; i < len(clientIds); i++ {
+			result := <-results
+
+			if result.err != nil || result.resp.Error != nil {
+				if result.err == nil && isKnownTransactionError(result.resp.Error) {
+					// the client already has the transaction, which is as good as accepting it
+					result.resp = &jsonrpc.Response{Result: json.RawMessage(strconv.Quote(hash))}
+				} else {
+					l.WithField("clientId", result.clientId).WithError(resultError(result)).Debug("client rejected transaction")
+					if firstFailure == nil {
+						firstFailure = &result
+					}
+					continue
+				}
+			}
+
+			if len(acceptedBy) == 0 {
+				accepted <- result.resp
+			}
+			acceptedBy = append(acceptedBy, result.clientId)
+		}
+
+		if len(acceptedBy) == 0 {
+			failed <- *firstFailure
+			return
+		}
+
+		l.WithField("acceptedBy", acceptedBy).Debug("transaction broadcast complete")
+
+		if _, err := r.transactionStore.Put(hash, eth.TransactionBroadcast{
+			Hash:       hash,
+			AcceptedBy: acceptedBy,
+			Timestamp:  time.Now(),
+		}); err != nil {
+			l.WithError(err).Error("failed to record transaction broadcast")
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case result := <-accepted:
+		resp.Result = result.Result
+		resp.Error = nil
+		return nil
+	case result := <-failed:
+		if result.err != nil {
+			return result.err
+		}
+		// surface the client's error, e.g. nonce too low, to the caller
+		resp.Error = result.resp.Error
+		return nil
+	}
+}
+
+// targets returns the ids of the clients the transaction should be sent to. Only clients close to the head
+// whose breaker is closed are considered healthy, direct clients are preferred and the selection rotates
+// when fan out is limited.
+func (r *BroadcastRouter) targets() []string {
+	head := r.chain.Head()
+	if head == nil {
+		return nil
+	}
+
+	minNumber := new(big.Int).Sub(head.Number, r.maxDistanceFromHead)
+	clientsByConnection := make(map[eth.ConnectionType][]string)
+
+	for _, state := range r.chain.Clients() {
+		if !state.HasBlock(minNumber) || !r.breakers.Allow(state.Id) {
+			continue
+		}
+
+		profile, err := getClientProfile(r.profileStore, r.profileCache, state.Id)
+		if err != nil {
+			r.log.WithError(err).WithField("clientId", state.Id).Error("failed to load client profile")
+			continue
+		}
+
+		clientsByConnection[profile.ConnectionType] = append(clientsByConnection[profile.ConnectionType], state.Id)
+	}
+
+	var result []string
+	offset := int(r.clientIdx.Add(1))
+
+	for _, connectionType := range eth.ConnectionTypes {
+		clientIds := clientsByConnection[connectionType]
+		// stable ordering for rotation
+		sort.Strings(clientIds)
+
+		for i := range clientIds {
+			result = append(result, clientIds[(offset+i)%len(clientIds)])
+		}
+	}
+
+	if r.fanOut > 0 && len(result) > r.fanOut {
+		result = result[:r.fanOut]
+	}
+
+	return result
+}
+
+// transactionHash derives the hash of the raw transaction in the first request param.
+func transactionHash(req jsonrpc.Request) (string, error) {
+	var params []string
+	if err := req.UnmarshalParams(&params); err != nil {
+		return "", err
+	}
+	if len(params) == 0 {
+		return "", errors.New("missing raw transaction param")
+	}
+
+	raw, err := hexutil.Decode(params[0])
+	if err != nil {
+		return "", err
+	}
+
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(raw)
+	return hexutil.Encode(hasher.Sum(nil)), nil
+}
+
+func isKnownTransactionError(err *jsonrpc.Error) bool {
+	message := strings.ToLower(err.Message)
+	for _, fragment := range knownTransactionErrors {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func resultError(result broadcastResult) error {
+	if result.err != nil {
+		return result.err
+	}
+	return result.resp.Error
+}
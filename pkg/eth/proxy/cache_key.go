@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"math/big"
+	"strings"
+
+	proxymethods "github.com/41north/tethys/pkg/eth/proxy/methods"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	// quantityParams are the positions of params, other than the block param, which are hex encoded quantities.
+	quantityParams = map[string][]int{
+		proxymethods.EthGetStorageAt:                        {1},
+		proxymethods.EthGetTransactionByBlockHashAndIndex:   {1},
+		proxymethods.EthGetTransactionByBlockNumberAndIndex: {1},
+		proxymethods.EthGetUncleByBlockHashAndIndex:         {1},
+		proxymethods.EthGetUncleByBlockNumberAndIndex:       {1},
+		proxymethods.EthFeeHistory:                          {0},
+	}
+
+	// quantityFields are the fields within param objects, e.g. call and filter objects, which are hex encoded quantities.
+	quantityFields = map[string]bool{
+		"gas":                  true,
+		"gasPrice":             true,
+		"maxFeePerGas":         true,
+		"maxPriorityFeePerGas": true,
+		"value":                true,
+		"nonce":                true,
+		"chainId":              true,
+		"type":                 true,
+		"fromBlock":            true,
+		"toBlock":              true,
+		"blockNumber":          true,
+	}
+)
+
+// cacheKey builds a cache key from the request params after normalising them, so that semantically equal
+// requests share a cache entry.
+func cacheKey(method string, params []any, blockParamIdx int) (string, error) {
+	normalised := make([]any, len(params))
+	for idx, param := range params {
+		if idx == blockParamIdx || containsInt(quantityParams[method], idx) {
+			param = normaliseQuantity(param)
+		}
+		normalised[idx] = normaliseParam(param)
+	}
+	return natsutil.CacheKey(method, normalised)
+}
+
+// normaliseParam lowercases hex strings, e.g. addresses and hashes, and canonicalises quantity fields
+// within objects.
+func normaliseParam(param any) any {
+	switch value := param.(type) {
+	case string:
+		if isHex(value) {
+			return strings.ToLower(value)
+		}
+		return value
+	case []any:
+		result := make([]any, len(value))
+		for idx, item := range value {
+			result[idx] = normaliseParam(item)
+		}
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(value))
+		for key, item := range value {
+			if quantityFields[key] {
+				item = normaliseQuantity(item)
+			}
+			result[key] = normaliseParam(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// normaliseQuantity removes leading zeros from a hex encoded quantity. Anything else, e.g. a block tag, is
+// returned as is.
+func normaliseQuantity(param any) any {
+	value, ok := param.(string)
+	if !ok || !isHex(value) {
+		return param
+	}
+	number, ok := new(big.Int).SetString(value[2:], 16)
+	if !ok {
+		return param
+	}
+	return hexutil.EncodeBig(number)
+}
+
+func isHex(value string) bool {
+	return len(value) > 2 && value[0] == '0' && (value[1] == 'x' || value[1] == 'X')
+}
+
+func containsInt(values []int, value int) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,440 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	"github.com/41north/tethys/pkg/eth/tracking"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/viney-shih/go-cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultConfirmationDepth is the number of blocks below the head after which a block is considered safe
+	// from re-orgs for the purposes of caching.
+	DefaultConfirmationDepth = 12
+
+	// recentCacheTTL is the maximum time responses for blocks within the confirmation depth are cached locally.
+	recentCacheTTL = 1 * time.Minute
+
+	// errSkipCache is returned from the cache getter to prevent a response from being cached.
+	errSkipCache = errors.ConstError("response should not be cached")
+)
+
+// cacheTier determines where a response is cached, if at all.
+type cacheTier int
+
+const (
+	cacheTierNone cacheTier = iota
+	// cacheTierRecent caches locally for a short time, the block may still be re-orged.
+	cacheTierRecent
+	// cacheTierConfirmed caches according to the method's policy, the response will not change.
+	cacheTierConfirmed
+)
+
+// recentBlock tracks the cache keys, and their prefixes, for a block within the confirmation depth so they
+// can be evicted if the block is dropped by a re-org.
+type recentBlock struct {
+	number *big.Int
+	keys   map[string]string
+}
+
+// CacheStats counts the cache lookups made by a BlockCachingRouter.
+type CacheStats struct {
+	// Hits is the number of responses served from the cache.
+	Hits uint64 `json:"hits"`
+	// Misses is the number of responses which had to be requested from a client.
+	Misses uint64 `json:"misses"`
+	// Prefixes are the caches in use, one per combination of TTL and locality.
+	Prefixes []string `json:"prefixes"`
+	// RecentBlocks is the number of blocks within the confirmation depth whose responses are being tracked.
+	RecentBlocks int `json:"recentBlocks"`
+}
+
+// BlockCachingRouter caches responses keyed by the canonical block hash at request time, rather than the
+// block number, so that a re-org never results in a stale response. Responses for blocks within the
+// confirmation depth are only cached locally for a short time and are evicted if the block is dropped.
+// Responses for confirmed or finalized blocks are cached according to the cache policy of the method.
+type BlockCachingRouter struct {
+	cacheFactory *natsutil.CacheFactory
+
+	// caches are created on demand for each combination of TTL and locality, keyed by prefix
+	cachesMutex sync.Mutex
+	caches      map[string]cache.Cache
+
+	chain             *tracking.CanonicalChain
+	delegate          natsutil.Router
+	confirmationDepth *big.Int
+
+	recentMutex  sync.Mutex
+	recentBlocks map[string]*recentBlock
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	log *log.Entry
+}
+
+func NewBlockCachingRouter(
+	cacheFactory *natsutil.CacheFactory,
+	chain *tracking.CanonicalChain,
+	delegate natsutil.Router,
+	confirmationDepth int,
+) *BlockCachingRouter {
+	router := &BlockCachingRouter{
+		cacheFactory:      cacheFactory,
+		caches:            make(map[string]cache.Cache),
+		chain:             chain,
+		delegate:          delegate,
+		confirmationDepth: big.NewInt(int64(confirmationDepth)),
+		recentBlocks:      make(map[string]*recentBlock),
+		log: log.WithFields(log.Fields{
+			"component":         "BlockCachingRouter",
+			"confirmationDepth": confirmationDepth,
+		}),
+	}
+
+	reorgs := make(chan tracking.ReorgEvent, 32)
+	chain.AddReorgListener(reorgs)
+
+	go router.listenForReorgs(reorgs)
+
+	return router
+}
+
+func (r *BlockCachingRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...natsutil.RouteOpt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.RequestWithContext(ctx, req, resp, options...)
+}
+
+func (r *BlockCachingRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, options ...natsutil.RouteOpt) error {
+	opts, err := natsutil.BuildRouteOpts(options...)
+	if err != nil {
+		return err
+	}
+
+	if !opts.Cache {
+		// caching is disabled for this request
+		return r.delegate.RequestWithContext(ctx, req, resp, options...)
+	}
+
+	var params []any
+	if err = natsutil.UnmarshalParams(req.Params, &params); err != nil {
+		return errors.Annotate(err, "failed to unmarshal params array")
+	}
+
+	policy := opts.CachePolicy
+
+	tier, block := r.tier(req, opts.BlockParamIdx, policy)
+	if tier == cacheTierNone {
+		return r.delegate.RequestWithContext(ctx, req, resp, options...)
+	}
+
+	// a block number param is replaced with the canonical hash
+	if block != nil {
+		params[opts.BlockParamIdx] = block.BlockHash
+	}
+
+	key, err := cacheKey(req.Method, params, opts.BlockParamIdx)
+	if err != nil {
+		return errors.Annotate(err, "failed to build cache key")
+	}
+
+	ttl, localOnly := policy.TTL, policy.LocalOnly
+	if tier == cacheTierRecent {
+		if ttl > recentCacheTTL {
+			ttl = recentCacheTTL
+		}
+		localOnly = true
+	}
+
+	responseCache, prefix := r.cacheFor(ttl, localOnly)
+
+	if tier == cacheTierRecent && block != nil {
+		r.trackRecent(block, key, prefix)
+	}
+
+	// without a block param the response itself must show it is finalized
+	checkFinalized := policy.FinalizedOnly && opts.BlockParamIdx < 0
+
+	l := r.log.WithFields(log.Fields{
+		"reqId":     string(req.Id),
+		"reqMethod": req.Method,
+		"cacheKey":  key,
+		"prefix":    prefix,
+	})
+	l.Debug("loading from cache")
+
+	hit := true
+	err = responseCache.GetByFunc(ctx, prefix, key, resp, func() (interface{}, error) {
+		l.Debug("cache miss")
+		hit = false
+		if err := r.delegate.RequestWithContext(ctx, req, resp, options...); err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.Error != nil:
+			// errors are not cached
+			return nil, errSkipCache
+		case block != nil && !matchesBlock(resp, block):
+			// nor are responses from a client on a different fork
+			return nil, errSkipCache
+		case policy.NonNullOnly && isNullResult(resp):
+			return nil, errSkipCache
+		case checkFinalized && !r.isFinalizedResult(resp):
+			return nil, errSkipCache
+		}
+		return resp, nil
+	})
+
+	span := trace.SpanFromContext(ctx)
+	switch {
+	case !hit:
+		r.misses.Add(1)
+		cacheRequestsTotal.WithLabelValues(req.Method, "miss").Inc()
+		span.SetAttributes(attribute.String("cache.result", "miss"))
+	case err == nil:
+		r.hits.Add(1)
+		cacheRequestsTotal.WithLabelValues(req.Method, "hit").Inc()
+		span.SetAttributes(attribute.String("cache.result", "hit"))
+	}
+
+	if errors.Is(err, errSkipCache) {
+		if resp.Result == nil && resp.Error == nil {
+			// a concurrent request for the same key was skipped, only its response was populated
+			return r.delegate.RequestWithContext(ctx, req, resp, options...)
+		}
+		return nil
+	}
+	return err
+}
+
+// Stats returns the cache lookups since the router was created.
+func (r *BlockCachingRouter) Stats() CacheStats {
+	r.cachesMutex.Lock()
+	prefixes := make([]string, 0, len(r.caches))
+	for prefix := range r.caches {
+		prefixes = append(prefixes, prefix)
+	}
+	r.cachesMutex.Unlock()
+	sort.Strings(prefixes)
+
+	r.recentMutex.Lock()
+	recentBlocks := len(r.recentBlocks)
+	r.recentMutex.Unlock()
+
+	return CacheStats{
+		Hits:         r.hits.Load(),
+		Misses:       r.misses.Load(),
+		Prefixes:     prefixes,
+		RecentBlocks: recentBlocks,
+	}
+}
+
+// cacheFor returns the cache and prefix for the combination of TTL and locality, creating it if required.
+func (r *BlockCachingRouter) cacheFor(ttl time.Duration, localOnly bool) (cache.Cache, string) {
+	prefix := fmt.Sprintf("%s_%s", r.cacheFactory.Bucket(), ttl)
+	if localOnly {
+		prefix += "_local"
+	}
+
+	r.cachesMutex.Lock()
+	defer r.cachesMutex.Unlock()
+
+	responseCache, ok := r.caches[prefix]
+	if !ok {
+		responseCache = r.cacheFactory.NewCache(natsutil.CacheSetting{
+			Prefix:    prefix,
+			TTL:       ttl,
+			LocalOnly: localOnly,
+		})
+		r.caches[prefix] = responseCache
+	}
+
+	return responseCache, prefix
+}
+
+// tier determines how the response should be cached based on the block param and the policy. For a block
+// number param the canonical block at that height is returned if it is being tracked.
+func (r *BlockCachingRouter) tier(req jsonrpc.Request, blockParamIdx int, policy natsutil.CachePolicy) (cacheTier, *tracking.Block) {
+	if blockParamIdx < 0 {
+		if policy.FinalizedOnly {
+			// determined from the response
+			return cacheTierConfirmed, nil
+		}
+		// no block to relate the response to, e.g. a transaction receipt which may change on re-org
+		return cacheTierRecent, nil
+	}
+
+	ref, ok := blockParam(req, blockParamIdx)
+	if !ok {
+		// pending or a missing param
+		return cacheTierNone, nil
+	}
+
+	finalized := r.chain.Finalized()
+
+	if ref.hash != "" {
+		// the response for a given hash never changes, but the block may not be finalized
+		if block, tracked := r.chain.BlockByHash(ref.hash); tracked && policy.FinalizedOnly {
+			if finalized == nil || finalized.Number.Cmp(block.Number) < 0 {
+				return cacheTierNone, nil
+			}
+		}
+		return cacheTierConfirmed, nil
+	}
+
+	head := r.chain.Head()
+	if head == nil || ref.number.Cmp(head.Number) > 0 {
+		return cacheTierNone, nil
+	}
+
+	isFinalized := finalized != nil && finalized.Number.Cmp(ref.number) >= 0
+	confirmed := isFinalized || new(big.Int).Sub(head.Number, ref.number).Cmp(r.confirmationDepth) >= 0
+
+	if policy.FinalizedOnly && !isFinalized {
+		return cacheTierNone, nil
+	}
+
+	block, ok := r.chain.CanonicalBlockByNumber(ref.number)
+	switch {
+	case ok && confirmed:
+		return cacheTierConfirmed, block
+	case ok:
+		return cacheTierRecent, block
+	case confirmed:
+		// older than the blocks being tracked, the number is as good as the hash
+		return cacheTierConfirmed, nil
+	default:
+		return cacheTierNone, nil
+	}
+}
+
+// isFinalizedResult checks the block number within the result, e.g. of a receipt, is finalized.
+func (r *BlockCachingRouter) isFinalizedResult(resp *jsonrpc.Response) bool {
+	finalized := r.chain.Finalized()
+	if finalized == nil {
+		return false
+	}
+
+	var result struct {
+		BlockNumber *hexutil.Big `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(resp.Result, &result); err != nil || result.BlockNumber == nil {
+		return false
+	}
+
+	return finalized.Number.Cmp(result.BlockNumber.ToInt()) >= 0
+}
+
+func (r *BlockCachingRouter) trackRecent(block *tracking.Block, key string, prefix string) {
+	r.recentMutex.Lock()
+	defer r.recentMutex.Unlock()
+
+	entry, ok := r.recentBlocks[block.BlockHash]
+	if !ok {
+		entry = &recentBlock{number: block.Number, keys: make(map[string]string)}
+		r.recentBlocks[block.BlockHash] = entry
+		r.pruneRecent()
+	}
+
+	entry.keys[key] = prefix
+}
+
+// pruneRecent stops tracking blocks which are now beyond the confirmation depth. Must be called with the
+// recent mutex held.
+func (r *BlockCachingRouter) pruneRecent() {
+	head := r.chain.Head()
+	if head == nil {
+		return
+	}
+	threshold := new(big.Int).Sub(head.Number, r.confirmationDepth)
+	for hash, entry := range r.recentBlocks {
+		if entry.number.Cmp(threshold) < 0 {
+			delete(r.recentBlocks, hash)
+		}
+	}
+}
+
+func (r *BlockCachingRouter) listenForReorgs(reorgs <-chan tracking.ReorgEvent) {
+	for event := range reorgs {
+		r.evict(event.Dropped)
+	}
+}
+
+// evict removes the cached responses for blocks which are no longer canonical.
+func (r *BlockCachingRouter) evict(hashes []string) {
+	keysByPrefix := make(map[string][]string)
+
+	r.recentMutex.Lock()
+	for _, hash := range hashes {
+		if entry, ok := r.recentBlocks[hash]; ok {
+			for key, prefix := range entry.keys {
+				keysByPrefix[prefix] = append(keysByPrefix[prefix], key)
+			}
+			delete(r.recentBlocks, hash)
+		}
+	}
+	r.recentMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for prefix, keys := range keysByPrefix {
+		r.cachesMutex.Lock()
+		responseCache := r.caches[prefix]
+		r.cachesMutex.Unlock()
+
+		if err := responseCache.Del(ctx, prefix, keys...); err != nil {
+			r.log.WithError(err).Warn("failed to evict responses for dropped blocks")
+			continue
+		}
+
+		r.log.WithFields(log.Fields{
+			"dropped": hashes,
+			"prefix":  prefix,
+			"evicted": len(keys),
+		}).Debug("evicted responses for dropped blocks")
+	}
+}
+
+// matchesBlock checks that a response which references a block, e.g. from eth_getBlockByNumber, is for the
+// expected block. Responses which do not reference a block are assumed to match.
+func matchesBlock(resp *jsonrpc.Response, block *tracking.Block) bool {
+	var result struct {
+		Hash       string `json:"hash"`
+		ParentHash string `json:"parentHash"`
+		BlockHash  string `json:"blockHash"`
+	}
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return true
+	}
+	switch {
+	case result.BlockHash != "":
+		// transactions, receipts and logs
+		return strings.EqualFold(result.BlockHash, block.BlockHash)
+	case result.ParentHash != "":
+		// blocks and uncles, the latter will not match but are rarely requested
+		return strings.EqualFold(result.Hash, block.BlockHash)
+	default:
+		return true
+	}
+}
+
+func isNullResult(resp *jsonrpc.Response) bool {
+	return len(resp.Result) == 0 || string(resp.Result) == "null"
+}
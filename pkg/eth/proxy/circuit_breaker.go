@@ -0,0 +1,232 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	proxymethods "github.com/41north/tethys/pkg/eth/proxy/methods"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultBreakerFailureThreshold is the number of consecutive failures after which a client's breaker opens.
+	DefaultBreakerFailureThreshold = 5
+
+	// DefaultBreakerOpenTimeout is how long a breaker remains open before the client is probed.
+	DefaultBreakerOpenTimeout = 10 * time.Second
+
+	// maxBreakerOpenTimeout bounds the back-off between probes of a client which keeps failing them.
+	maxBreakerOpenTimeout = 5 * time.Minute
+
+	// probeTimeout is how long a client has to answer a probe.
+	probeTimeout = 5 * time.Second
+)
+
+const (
+	// BreakerClosed is the normal state, requests are routed to the client.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen indicates the client has been failing, no requests are routed to it.
+	BreakerOpen
+	// BreakerHalfOpen indicates the client is being probed to determine if it has recovered.
+	BreakerHalfOpen
+)
+
+type BreakerState int
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return ""
+	}
+}
+
+type circuitBreaker struct {
+	state       BreakerState
+	failures    int
+	openTimeout time.Duration
+}
+
+// CircuitBreakers maintains a breaker for each client. A client's breaker opens after consecutive failures,
+// removing it from routing. Once the open timeout has elapsed the client is probed with a cheap request,
+// closing the breaker if it succeeds or re-opening it with a longer timeout if it fails.
+type CircuitBreakers struct {
+	conn          *nats.EncodedConn
+	subjectPrefix string
+
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mutex    sync.Mutex
+	breakers map[string]*circuitBreaker
+
+	// onChange is invoked whenever a client is removed from or returned to routing
+	onChange func()
+
+	log *log.Entry
+}
+
+func NewCircuitBreakers(
+	conn *nats.EncodedConn,
+	subjectPrefix string,
+	failureThreshold int,
+	openTimeout time.Duration,
+	onChange func(),
+) *CircuitBreakers {
+	return &CircuitBreakers{
+		conn:             conn,
+		subjectPrefix:    subjectPrefix,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		breakers:         make(map[string]*circuitBreaker),
+		onChange:         onChange,
+		log: log.WithFields(log.Fields{
+			"component":        "CircuitBreakers",
+			"failureThreshold": failureThreshold,
+		}),
+	}
+}
+
+// Allow determines if requests can be routed to the client.
+func (b *CircuitBreakers) Allow(clientId string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	breaker, ok := b.breakers[clientId]
+	return !ok || breaker.state == BreakerClosed
+}
+
+// States returns the state of every client's breaker.
+func (b *CircuitBreakers) States() map[string]BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	result := make(map[string]BreakerState, len(b.breakers))
+	for clientId, breaker := range b.breakers {
+		result[clientId] = breaker.state
+	}
+	return result
+}
+
+// Record updates the client's breaker with the outcome of a request.
+func (b *CircuitBreakers) Record(clientId string, failed bool) {
+	if b.failureThreshold <= 0 {
+		// disabled
+		return
+	}
+
+	b.mutex.Lock()
+
+	breaker, ok := b.breakers[clientId]
+	if !ok {
+		breaker = &circuitBreaker{openTimeout: b.openTimeout}
+		b.breakers[clientId] = breaker
+	}
+
+	// requests which were in flight when the breaker opened are ignored
+	if breaker.state != BreakerClosed {
+		b.mutex.Unlock()
+		return
+	}
+
+	if !failed {
+		breaker.failures = 0
+		b.mutex.Unlock()
+		return
+	}
+
+	breaker.failures += 1
+	if breaker.failures < b.failureThreshold {
+		b.mutex.Unlock()
+		return
+	}
+
+	b.open(clientId, breaker)
+	b.mutex.Unlock()
+
+	b.onChange()
+}
+
+// open must be called with the mutex held.
+func (b *CircuitBreakers) open(clientId string, breaker *circuitBreaker) {
+	breaker.state = BreakerOpen
+	breakerStateGauge.WithLabelValues(clientId).Set(float64(BreakerOpen))
+
+	b.log.WithFields(log.Fields{
+		"clientId":    clientId,
+		"failures":    breaker.failures,
+		"openTimeout": breaker.openTimeout,
+	}).Warn("circuit breaker opened")
+
+	time.AfterFunc(breaker.openTimeout, func() {
+		b.probe(clientId)
+	})
+}
+
+func (b *CircuitBreakers) probe(clientId string) {
+	b.mutex.Lock()
+	breaker := b.breakers[clientId]
+	breaker.state = BreakerHalfOpen
+	breakerStateGauge.WithLabelValues(clientId).Set(float64(BreakerHalfOpen))
+	b.mutex.Unlock()
+
+	l := b.log.WithField("clientId", clientId)
+	l.Debug("probing client")
+
+	err := b.sendProbe(clientId)
+
+	b.mutex.Lock()
+
+	if errors.Is(err, nats.ErrNoResponders) {
+		// the client has disconnected, should it reconnect it starts afresh
+		delete(b.breakers, clientId)
+		breakerStateGauge.DeleteLabelValues(clientId)
+		b.mutex.Unlock()
+		l.Debug("client has disconnected, circuit breaker removed")
+		b.onChange()
+		return
+	}
+
+	if err != nil {
+		l.WithError(err).Debug("probe failed")
+		breaker.openTimeout *= 2
+		if breaker.openTimeout > maxBreakerOpenTimeout {
+			breaker.openTimeout = maxBreakerOpenTimeout
+		}
+		b.open(clientId, breaker)
+		b.mutex.Unlock()
+		return
+	}
+
+	breaker.state = BreakerClosed
+	breakerStateGauge.WithLabelValues(clientId).Set(float64(BreakerClosed))
+	breaker.failures = 0
+	breaker.openTimeout = b.openTimeout
+	b.mutex.Unlock()
+
+	l.Info("circuit breaker closed")
+	b.onChange()
+}
+
+func (b *CircuitBreakers) sendProbe(clientId string) error {
+	req, err := jsonrpc.NewRequest(proxymethods.EthBlockNumber, nil)
+	if err != nil {
+		return err
+	}
+
+	var resp jsonrpc.Response
+	if err = b.conn.Request(natsutil.SubjectName(b.subjectPrefix, clientId), req, &resp, probeTimeout); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	return nil
+}
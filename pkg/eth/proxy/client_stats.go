@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencyDecay is the weight given to the latest latency sample in the moving average.
+	latencyDecay = 0.2
+
+	// errorDecay is the weight given to the latest outcome in the moving error rate.
+	errorDecay = 0.1
+
+	// maxErrorRate bounds the error penalty so that a failing client can still recover.
+	maxErrorRate = 0.95
+
+	// baseLatency is added to the average latency so that in-flight requests are penalised even for
+	// clients with no latency samples yet.
+	baseLatency = float64(time.Millisecond)
+)
+
+// clientStats tracks the recent performance of a client.
+type clientStats struct {
+	inFlight atomic.Int64
+
+	mutex     sync.Mutex
+	latency   float64
+	errorRate float64
+	samples   uint64
+}
+
+func (s *clientStats) record(latency time.Duration, failed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	outcome := 0.0
+	if failed {
+		outcome = 1.0
+	}
+	s.errorRate += errorDecay * (outcome - s.errorRate)
+
+	// a failure is often fast and would otherwise make the client look good
+	if failed {
+		return
+	}
+
+	if s.samples == 0 {
+		s.latency = float64(latency)
+	} else {
+		s.latency += latencyDecay * (float64(latency) - s.latency)
+	}
+	s.samples++
+}
+
+// cost estimates how long a request sent to the client now would take, adjusted for its error rate. Lower
+// is better, and clients without samples are cheap so that they are tried.
+func (s *clientStats) cost() float64 {
+	s.mutex.Lock()
+	latency, errorRate := s.latency, s.errorRate
+	s.mutex.Unlock()
+
+	if errorRate > maxErrorRate {
+		errorRate = maxErrorRate
+	}
+
+	inFlight := float64(s.inFlight.Load())
+	return (latency + baseLatency) * (inFlight + 1) / (1 - errorRate)
+}
+
+// ClientSelector chooses between clients using the power of two choices: two candidates are sampled at random
+// and the one with the lower cost, based on moving averages of latency and error rate and the number of
+// requests in flight, is selected. This avoids the herding of always choosing the best client whilst
+// favouring the faster clients.
+type ClientSelector struct {
+	stats sync.Map
+}
+
+func NewClientSelector() *ClientSelector {
+	return &ClientSelector{}
+}
+
+func (s *ClientSelector) statsFor(clientId string) *clientStats {
+	stats, _ := s.stats.LoadOrStore(clientId, &clientStats{})
+	return stats.(*clientStats)
+}
+
+// Select returns one of the candidates, or false if there are none.
+func (s *ClientSelector) Select(candidates []string) (string, bool) {
+	switch len(candidates) {
+	case 0:
+		return "", false
+	case 1:
+		return candidates[0], true
+	}
+
+	first := rand.Intn(len(candidates))
+	second := rand.Intn(len(candidates) - 1)
+	if second >= first {
+		second++
+	}
+
+	a, b := candidates[first], candidates[second]
+	if s.statsFor(b).cost() < s.statsFor(a).cost() {
+		return b, true
+	}
+	return a, true
+}
+
+// Begin marks the start of a request to the client. The returned func must be called with the outcome once
+// the request has completed, a cancelled request should not be recorded.
+func (s *ClientSelector) Begin(clientId string) func(record bool, failed bool) {
+	stats := s.statsFor(clientId)
+	stats.inFlight.Add(1)
+	start := time.Now()
+
+	return func(record bool, failed bool) {
+		stats.inFlight.Add(-1)
+		if record {
+			stats.record(time.Since(start), failed)
+		}
+	}
+}
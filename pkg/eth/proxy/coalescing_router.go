@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// coalescedRequestTimeout bounds a shared request, which is not bound to the context of any one caller.
+	coalescedRequestTimeout = 10 * time.Second
+)
+
+// CoalescingStats counts the requests seen by a CoalescingRouter.
+type CoalescingStats struct {
+	// Requests is the total number of requests received.
+	Requests uint64 `json:"requests"`
+	// Coalesced is the number of requests which were served by an identical request already in flight.
+	Coalesced uint64 `json:"coalesced"`
+}
+
+// CoalescingRouter ensures only one request is made to the delegate for identical requests which are in
+// flight at the same time, e.g. many callers requesting a block the moment it arrives. Requests are
+// identified by the same normalised key used for caching.
+type CoalescingRouter struct {
+	delegate natsutil.Router
+	group    singleflight.Group
+
+	requests  atomic.Uint64
+	coalesced atomic.Uint64
+
+	log *log.Entry
+}
+
+type coalescedResponse struct {
+	result []byte
+	err    *jsonrpc.Error
+}
+
+func NewCoalescingRouter(delegate natsutil.Router) *CoalescingRouter {
+	return &CoalescingRouter{
+		delegate: delegate,
+		log: log.WithFields(log.Fields{
+			"component": "CoalescingRouter",
+		}),
+	}
+}
+
+// Stats returns the request counts since the router was created.
+func (r *CoalescingRouter) Stats() CoalescingStats {
+	return CoalescingStats{
+		Requests:  r.requests.Load(),
+		Coalesced: r.coalesced.Load(),
+	}
+}
+
+func (r *CoalescingRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...natsutil.RouteOpt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.RequestWithContext(ctx, req, resp, options...)
+}
+
+func (r *CoalescingRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, options ...natsutil.RouteOpt) error {
+	r.requests.Add(1)
+
+	opts, err := natsutil.BuildRouteOpts(options...)
+	if err != nil {
+		return err
+	}
+
+	var params []any
+	if err = natsutil.UnmarshalParams(req.Params, &params); err != nil {
+		// let a client report the problem with the params
+		return r.delegate.RequestWithContext(ctx, req, resp, options...)
+	}
+
+	key, err := cacheKey(req.Method, params, opts.BlockParamIdx)
+	if err != nil {
+		return errors.Annotate(err, "failed to build coalescing key")
+	}
+
+	// only the leader executes the function, singleflight reports every caller as shared once there are waiters
+	var leader bool
+
+	ch := r.group.DoChan(key, func() (interface{}, error) {
+		leader = true
+
+		// the request is shared so it must not be cancelled, or time out, with the context of the leader. The
+		// trace of the leader is continued.
+		sharedCtx, cancel := context.WithTimeout(
+			trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx)),
+			coalescedRequestTimeout,
+		)
+		defer cancel()
+
+		var leaderResp jsonrpc.Response
+		if err := r.delegate.RequestWithContext(sharedCtx, req, &leaderResp, options...); err != nil {
+			return nil, err
+		}
+		return coalescedResponse{result: leaderResp.Result, err: leaderResp.Error}, nil
+	})
+
+	var result singleflight.Result
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case result = <-ch:
+	}
+
+	if !leader {
+		r.coalesced.Add(1)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("coalesced", true))
+		r.log.WithFields(log.Fields{
+			"reqMethod": req.Method,
+			"key":       key,
+		}).Debug("request coalesced")
+	}
+
+	if result.Err != nil {
+		return result.Err
+	}
+
+	// each waiter receives its own copy, the id of the response is left as is
+	shared := result.Val.(coalescedResponse)
+	resp.Result = append([]byte(nil), shared.result...)
+	resp.Error = nil
+	if shared.err != nil {
+		rpcErr := *shared.err
+		resp.Error = &rpcErr
+	}
+
+	return nil
+}
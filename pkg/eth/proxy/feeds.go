@@ -0,0 +1,442 @@
+package proxy
+
+import (
+	"encoding/json"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/41north/tethys/pkg/eth/tracking"
+	"github.com/41north/tethys/pkg/eth/web3"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/btree"
+)
+
+const (
+	// maxHeadersRetained is the number of block headers below the canonical head kept by a newHeadsFeed.
+	maxHeadersRetained = 128
+	// maxHeadsBackfill is the max number of canonical ancestors emitted when the head jumps forward by more than one block.
+	maxHeadsBackfill = 12
+)
+
+type header struct {
+	number *big.Int
+	raw    json.RawMessage
+	// emitted is set once the header has been sent to subscribers
+	emitted bool
+}
+
+// newHeadsFeed combines the new heads published by all clients into a single de-duplicated feed of
+// canonical heads as determined by the CanonicalChain.
+type newHeadsFeed struct {
+	chain *tracking.CanonicalChain
+
+	mutex       sync.Mutex
+	headers     btree.Map[string, header]
+	subscribers map[string]chan<- json.RawMessage
+
+	sub *nats.Subscription
+	log *log.Entry
+}
+
+func newNewHeadsFeed(js nats.JetStreamContext, subject string, chain *tracking.CanonicalChain) (*newHeadsFeed, error) {
+	feed := &newHeadsFeed{
+		chain:       chain,
+		subscribers: make(map[string]chan<- json.RawMessage),
+		log:         log.WithField("component", "newHeadsFeed"),
+	}
+
+	sub, err := js.Subscribe(subject, feed.onMsg, nats.DeliverNew(), nats.AckNone())
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to subscribe to subject: %s", subject)
+	}
+	feed.sub = sub
+
+	chainUpdates := make(chan *tracking.CanonicalChain, 32)
+	chain.AddListener(chainUpdates)
+
+	go func() {
+		for range chainUpdates {
+			feed.onChainUpdate()
+		}
+	}()
+
+	return feed, nil
+}
+
+func (f *newHeadsFeed) subscribe(ch chan<- json.RawMessage) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	id := newSubscriptionId()
+	f.subscribers[id] = ch
+	return id
+}
+
+func (f *newHeadsFeed) unsubscribe(id string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	ch, ok := f.subscribers[id]
+	if ok {
+		delete(f.subscribers, id)
+		close(ch)
+	}
+	return ok
+}
+
+func (f *newHeadsFeed) onMsg(msg *nats.Msg) {
+	var head web3.NewHead
+	if err := json.Unmarshal(msg.Data, &head); err != nil {
+		f.log.WithError(err).Warn("failed to unmarshal new head")
+		return
+	}
+
+	number, err := hexutil.DecodeBig(head.Number)
+	if err != nil {
+		f.log.WithError(err).Warn("failed to decode new head block number")
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, exists := f.headers.Get(head.Hash); exists {
+		// already received from another client
+		return
+	}
+	f.headers.Set(head.Hash, header{number: number, raw: msg.Data})
+
+	// the canonical chain may have moved to this block before its header arrived
+	f.emitCanonical()
+}
+
+func (f *newHeadsFeed) onChainUpdate() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.emitCanonical()
+	f.prune()
+}
+
+// emitCanonical sends any canonical heads which have not yet been emitted to all subscribers. After a re-org
+// only the blocks above the common ancestor are emitted. It must be called whilst holding the mutex.
+func (f *newHeadsFeed) emitCanonical() {
+	head := f.chain.Head()
+	if head == nil {
+		return
+	}
+
+	// collect the canonical blocks which have not been emitted, oldest last
+	var pending []string
+	block := head
+	for block != nil && len(pending) < maxHeadsBackfill {
+		h, ok := f.headers.Get(block.BlockHash)
+		if !ok {
+			if block == head {
+				// the header for the head has not arrived yet, wait for it
+				return
+			}
+			break
+		}
+		if h.emitted {
+			break
+		}
+		pending = append(pending, block.BlockHash)
+		block, _ = f.chain.BlockByHash(block.ParentHash)
+	}
+
+	for idx := len(pending) - 1; idx >= 0; idx-- {
+		h, _ := f.headers.Get(pending[idx])
+		h.emitted = true
+		f.headers.Set(pending[idx], h)
+
+		for id, ch := range f.subscribers {
+			select {
+			case ch <- h.raw:
+			default:
+				f.log.WithField("subscriptionId", id).Warn("subscriber is not keeping up, dropping head")
+			}
+		}
+	}
+}
+
+// prune removes headers which are too far below the canonical head. It must be called whilst holding the mutex.
+func (f *newHeadsFeed) prune() {
+	head := f.chain.Head()
+	if head == nil {
+		return
+	}
+
+	minNumber := new(big.Int).Sub(head.Number, big.NewInt(maxHeadersRetained))
+
+	var stale []string
+	f.headers.Scan(func(hash string, h header) bool {
+		if h.number.Cmp(minNumber) < 0 {
+			stale = append(stale, hash)
+		}
+		return true
+	})
+
+	for _, hash := range stale {
+		f.headers.Delete(hash)
+	}
+}
+
+func (f *newHeadsFeed) close() {
+	if err := f.sub.Unsubscribe(); err != nil {
+		f.log.WithError(err).Warn("failed to unsubscribe from new heads")
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for id, ch := range f.subscribers {
+		delete(f.subscribers, id)
+		close(ch)
+	}
+}
+
+func newSubscriptionId() string {
+	id := uuid.New()
+	return hexutil.Encode(id[:])
+}
+
+const (
+	// maxLogsDepth is the number of canonical blocks below the head for which logs are tracked and
+	// removals can be emitted on a re-org.
+	maxLogsDepth = 64
+)
+
+type logsSubscriber struct {
+	filter web3.LogFilter
+	ch     chan<- json.RawMessage
+}
+
+type blockLogs struct {
+	number uint64
+	logs   btree.Map[uint64, web3.Log]
+}
+
+// logsFeed combines the logs published by all clients into a single de-duplicated feed of logs for
+// canonical blocks as determined by the CanonicalChain. When a block is no longer canonical its logs
+// are re-emitted with removed set to true.
+type logsFeed struct {
+	chain *tracking.CanonicalChain
+
+	mutex       sync.Mutex
+	blocks      map[string]*blockLogs
+	emitted     map[uint64]string
+	subscribers map[string]logsSubscriber
+
+	sub *nats.Subscription
+	log *log.Entry
+}
+
+func newLogsFeed(js nats.JetStreamContext, subject string, chain *tracking.CanonicalChain) (*logsFeed, error) {
+	feed := &logsFeed{
+		chain:       chain,
+		blocks:      make(map[string]*blockLogs),
+		emitted:     make(map[uint64]string),
+		subscribers: make(map[string]logsSubscriber),
+		log:         log.WithField("component", "logsFeed"),
+	}
+
+	sub, err := js.Subscribe(subject, feed.onMsg, nats.DeliverNew(), nats.AckNone())
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to subscribe to subject: %s", subject)
+	}
+	feed.sub = sub
+
+	chainUpdates := make(chan *tracking.CanonicalChain, 32)
+	chain.AddListener(chainUpdates)
+
+	go func() {
+		for range chainUpdates {
+			feed.onChainUpdate()
+		}
+	}()
+
+	return feed, nil
+}
+
+func (f *logsFeed) subscribe(filter web3.LogFilter, ch chan<- json.RawMessage) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	id := newSubscriptionId()
+	f.subscribers[id] = logsSubscriber{filter: filter, ch: ch}
+	return id
+}
+
+func (f *logsFeed) unsubscribe(id string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	subscriber, ok := f.subscribers[id]
+	if ok {
+		delete(f.subscribers, id)
+		close(subscriber.ch)
+	}
+	return ok
+}
+
+func (f *logsFeed) onMsg(msg *nats.Msg) {
+	var l web3.Log
+	if err := json.Unmarshal(msg.Data, &l); err != nil {
+		f.log.WithError(err).Warn("failed to unmarshal log")
+		return
+	}
+
+	number, err := l.BlockNumberU64()
+	if err != nil {
+		f.log.WithError(err).Warn("failed to decode log block number")
+		return
+	}
+
+	logIndex, err := l.LogIndexU64()
+	if err != nil {
+		f.log.WithError(err).Warn("failed to decode log index")
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	block, ok := f.blocks[l.BlockHash]
+	if !ok {
+		block = &blockLogs{number: number}
+		f.blocks[l.BlockHash] = block
+	}
+
+	if _, exists := block.logs.Get(logIndex); exists {
+		// already received from another client
+		return
+	}
+	block.logs.Set(logIndex, l)
+
+	// if the block is already canonical the log is emitted straight away
+	if f.emitted[number] == l.BlockHash {
+		f.emit(&l)
+	}
+}
+
+func (f *logsFeed) onChainUpdate() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	head := f.chain.Head()
+	if head == nil {
+		return
+	}
+
+	headNumber := head.Number.Uint64()
+
+	// walk back from the head collecting the canonical blocks, oldest last
+	var canonical []*tracking.Block
+	block := head
+	for block != nil && len(canonical) < maxLogsDepth {
+		if f.emitted[block.Number.Uint64()] == block.BlockHash {
+			// everything below this point has already been emitted
+			break
+		}
+		canonical = append(canonical, block)
+		block, _ = f.chain.BlockByHash(block.ParentHash)
+	}
+
+	// collect the emitted blocks which have been re-orged out, including those left above the new head by a
+	// re-org onto a shorter chain
+	var removed []uint64
+	for number := range f.emitted {
+		if number > headNumber {
+			removed = append(removed, number)
+		}
+	}
+	for _, block := range canonical {
+		if _, ok := f.emitted[block.Number.Uint64()]; ok {
+			removed = append(removed, block.Number.Uint64())
+		}
+	}
+
+	// unwind the removed logs from the newest block back, as a client would see them
+	sort.Slice(removed, func(i, j int) bool { return removed[i] > removed[j] })
+	for _, number := range removed {
+		f.emitBlock(f.emitted[number], true)
+		delete(f.emitted, number)
+	}
+
+	for idx := len(canonical) - 1; idx >= 0; idx-- {
+		block := canonical[idx]
+		f.emitted[block.Number.Uint64()] = block.BlockHash
+		f.emitBlock(block.BlockHash, false)
+	}
+
+	f.prune(headNumber)
+}
+
+// emitBlock emits all the logs received so far for the block in log index order. It must be called whilst holding
+// the mutex.
+func (f *logsFeed) emitBlock(hash string, removed bool) {
+	block, ok := f.blocks[hash]
+	if !ok {
+		return
+	}
+	block.logs.Scan(func(_ uint64, l web3.Log) bool {
+		l.Removed = removed
+		f.emit(&l)
+		return true
+	})
+}
+
+// emit sends the log to all subscribers with a matching filter. It must be called whilst holding the mutex.
+func (f *logsFeed) emit(l *web3.Log) {
+	var bytes []byte
+	for id, subscriber := range f.subscribers {
+		if !subscriber.filter.Matches(l) {
+			continue
+		}
+		if bytes == nil {
+			var err error
+			if bytes, err = json.Marshal(l); err != nil {
+				f.log.WithError(err).Error("failed to marshal log")
+				return
+			}
+		}
+		select {
+		case subscriber.ch <- bytes:
+		default:
+			f.log.WithField("subscriptionId", id).Warn("subscriber is not keeping up, dropping log")
+		}
+	}
+}
+
+// prune removes state for blocks which are too far below the head. It must be called whilst holding the mutex.
+func (f *logsFeed) prune(headNumber uint64) {
+	if headNumber < maxLogsDepth {
+		return
+	}
+	minNumber := headNumber - maxLogsDepth
+
+	for hash, block := range f.blocks {
+		if block.number < minNumber {
+			delete(f.blocks, hash)
+		}
+	}
+
+	for number := range f.emitted {
+		if number < minNumber {
+			delete(f.emitted, number)
+		}
+	}
+}
+
+func (f *logsFeed) close() {
+	if err := f.sub.Unsubscribe(); err != nil {
+		f.log.WithError(err).Warn("failed to unsubscribe from logs")
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for id, subscriber := range f.subscribers {
+		delete(f.subscribers, id)
+		close(subscriber.ch)
+	}
+}
@@ -0,0 +1,338 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	"github.com/41north/tethys/pkg/eth"
+	natseth "github.com/41north/tethys/pkg/eth/nats"
+	proxymethods "github.com/41north/tethys/pkg/eth/proxy/methods"
+	"github.com/41north/tethys/pkg/eth/tracking"
+	"github.com/41north/tethys/pkg/eth/web3"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxFilterUpdateAttempts bounds the retries when another proxy instance polls the same filter concurrently.
+	maxFilterUpdateAttempts = 3
+)
+
+var (
+	errFilterNotFound = jsonrpc.Error{
+		Code:    -32000,
+		Message: "filter not found",
+	}
+)
+
+// FilterRouter implements the filter methods within the proxy rather than forwarding them, as a filter
+// installed on one client is unknown to the others. Filter definitions are held in a KV store so they
+// survive restarts and are shared between proxy instances. Block filter changes are derived from the
+// canonical chain and log filter changes are fetched with eth_getLogs for the blocks since the last poll.
+type FilterRouter struct {
+	chain   *tracking.CanonicalChain
+	store   natseth.FilterStore
+	invoker invokeFn
+
+	log *log.Entry
+}
+
+func NewFilterRouter(
+	chain *tracking.CanonicalChain,
+	store natseth.FilterStore,
+	invoker invokeFn,
+) natsutil.Router {
+	return &FilterRouter{
+		chain:   chain,
+		store:   store,
+		invoker: invoker,
+		log: log.WithFields(log.Fields{
+			"component": "FilterRouter",
+		}),
+	}
+}
+
+func (r *FilterRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...natsutil.RouteOpt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.RequestWithContext(ctx, req, resp, options...)
+}
+
+func (r *FilterRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, _ ...natsutil.RouteOpt) error {
+	var result any
+	var err error
+
+	switch req.Method {
+	case proxymethods.EthNewFilter:
+		result, err = r.newLogFilter(req)
+	case proxymethods.EthNewBlockFilter:
+		result, err = r.newBlockFilter()
+	case proxymethods.EthGetFilterChanges:
+		result, err = r.filterChanges(ctx, req)
+	case proxymethods.EthGetFilterLogs:
+		result, err = r.filterLogs(ctx, req)
+	case proxymethods.EthUninstallFilter:
+		result, err = r.uninstall(req)
+	default:
+		return errors.Errorf("unsupported filter method: %s", req.Method)
+	}
+
+	if err != nil {
+		var rpcErr *jsonrpc.Error
+		if errors.As(err, &rpcErr) {
+			resp.Error = rpcErr
+			return nil
+		}
+		return err
+	}
+
+	if raw, ok := result.(json.RawMessage); ok {
+		resp.Result = raw
+		return nil
+	}
+
+	resp.Result, err = json.Marshal(result)
+	return err
+}
+
+func (r *FilterRouter) newLogFilter(req jsonrpc.Request) (string, error) {
+	var params []web3.LogFilter
+	if err := req.UnmarshalParams(&params); err != nil || len(params) != 1 {
+		return "", &jsonrpc.ErrInvalidParams
+	}
+	return r.install(eth.FilterTypeLogs, &params[0])
+}
+
+func (r *FilterRouter) newBlockFilter() (string, error) {
+	return r.install(eth.FilterTypeBlock, nil)
+}
+
+func (r *FilterRouter) install(filterType eth.FilterType, criteria *web3.LogFilter) (string, error) {
+	head := r.chain.Head()
+	if head == nil {
+		return "", natsutil.ErrNoClientsAvailable
+	}
+
+	// changes are reported from the current head onwards
+	filter := eth.Filter{
+		Id:       newSubscriptionId(),
+		Type:     filterType,
+		Criteria: criteria,
+		Cursor: web3.BlockRef{
+			BlockNumber: hexutil.EncodeBig(head.Number),
+			BlockHash:   head.BlockHash,
+		},
+	}
+
+	if _, err := r.store.Put(filter.Id, filter); err != nil {
+		return "", errors.Annotate(err, "failed to store filter")
+	}
+
+	r.log.WithFields(log.Fields{"id": filter.Id, "type": filterType}).Debug("filter installed")
+
+	return filter.Id, nil
+}
+
+func (r *FilterRouter) uninstall(req jsonrpc.Request) (bool, error) {
+	id, err := filterIdParam(req)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = r.store.Get(id); err == nats.ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if err = r.store.Delete(id); err != nil {
+		return false, errors.Annotate(err, "failed to delete filter")
+	}
+	return true, nil
+}
+
+// filterChanges returns the changes since the last poll and advances the filter's cursor. The update is
+// conditional on the revision that was read so concurrent polls from other proxy instances are not lost.
+func (r *FilterRouter) filterChanges(ctx context.Context, req jsonrpc.Request) (any, error) {
+	id, err := filterIdParam(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < maxFilterUpdateAttempts; attempt++ {
+		filter, revision, err := r.load(id)
+		if err != nil {
+			return nil, err
+		}
+
+		head := r.chain.Head()
+		if head == nil {
+			return nil, natsutil.ErrNoClientsAvailable
+		}
+
+		var result any
+		switch filter.Type {
+		case eth.FilterTypeBlock:
+			result = r.blockChanges(filter, head)
+		case eth.FilterTypeLogs:
+			if result, err = r.logChanges(ctx, req, filter, head); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.Errorf("unknown filter type: %s", filter.Type)
+		}
+
+		filter.Cursor = web3.BlockRef{
+			BlockNumber: hexutil.EncodeBig(head.Number),
+			BlockHash:   head.BlockHash,
+		}
+
+		if _, err = r.store.Update(id, filter, revision); err == nil {
+			return result, nil
+		}
+
+		r.log.WithError(err).WithField("id", id).Debug("filter updated concurrently, retrying")
+	}
+
+	return nil, errors.New("filter is being polled concurrently")
+}
+
+// filterLogs returns all the logs matching the filter criteria.
+func (r *FilterRouter) filterLogs(ctx context.Context, req jsonrpc.Request) (json.RawMessage, error) {
+	id, err := filterIdParam(req)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, revision, err := r.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Type != eth.FilterTypeLogs {
+		return nil, &errFilterNotFound
+	}
+
+	result, err := r.getLogs(ctx, req, *filter.Criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the filter alive, a failure here only means another instance has touched it
+	_, _ = r.store.Update(id, filter, revision)
+
+	return result, nil
+}
+
+// blockChanges returns the hashes of the canonical blocks added since the cursor. When the cursor has been
+// replaced by a re-org the new blocks are returned back to the common ancestor.
+func (r *FilterRouter) blockChanges(filter eth.Filter, head *tracking.Block) []string {
+	cursorNumber, err := filter.Cursor.BlockNumberBI()
+	if err != nil {
+		cursorNumber = head.Number
+	}
+
+	// the cursor and its ancestors, limited to the blocks the chain is tracking
+	ancestors := make(map[string]bool)
+	for block, ok := r.chain.BlockByHash(filter.Cursor.BlockHash); ok; block, ok = r.chain.BlockByHash(block.ParentHash) {
+		ancestors[block.BlockHash] = true
+	}
+
+	var hashes []string
+	for block, ok := head, true; ok; block, ok = r.chain.BlockByHash(block.ParentHash) {
+		if ancestors[block.BlockHash] {
+			break
+		}
+		if len(ancestors) == 0 && block.Number.Cmp(cursorNumber) <= 0 {
+			// the cursor is no longer tracked, fall back to the block number
+			break
+		}
+		hashes = append(hashes, block.BlockHash)
+	}
+
+	// oldest first
+	result := make([]string, 0, len(hashes))
+	for idx := len(hashes) - 1; idx >= 0; idx-- {
+		result = append(result, hashes[idx])
+	}
+	return result
+}
+
+// logChanges fetches the logs matching the filter criteria in the blocks after the cursor up to the head.
+// Logs removed by a re-org are not reported.
+func (r *FilterRouter) logChanges(ctx context.Context, req jsonrpc.Request, filter eth.Filter, head *tracking.Block) (json.RawMessage, error) {
+	cursorNumber, err := filter.Cursor.BlockNumberBI()
+	if err != nil {
+		return nil, errors.Annotate(err, "invalid filter cursor")
+	}
+
+	from := new(big.Int).Add(cursorNumber, big.NewInt(1))
+	to := head.Number
+
+	if number, err := hexutil.DecodeBig(filter.Criteria.FromBlock); err == nil && number.Cmp(from) > 0 {
+		from = number
+	}
+	if number, err := hexutil.DecodeBig(filter.Criteria.ToBlock); err == nil && number.Cmp(to) < 0 {
+		to = number
+	}
+
+	if from.Cmp(to) > 0 {
+		return json.RawMessage("[]"), nil
+	}
+
+	criteria := *filter.Criteria
+	criteria.FromBlock = hexutil.EncodeBig(from)
+	criteria.ToBlock = hexutil.EncodeBig(to)
+
+	return r.getLogs(ctx, req, criteria)
+}
+
+// getLogs invokes eth_getLogs through the method table so the usual block tag handling and range splitting apply.
+func (r *FilterRouter) getLogs(ctx context.Context, req jsonrpc.Request, criteria web3.LogFilter) (json.RawMessage, error) {
+	params, err := json.Marshal([]web3.LogFilter{criteria})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp jsonrpc.Response
+	r.invoker(ctx, jsonrpc.Request{
+		Id:      req.Id,
+		Method:  proxymethods.EthGetLogs,
+		Params:  params,
+		Version: req.Version,
+	}, &resp)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result, nil
+}
+
+func (r *FilterRouter) load(id string) (eth.Filter, uint64, error) {
+	entry, err := r.store.Get(id)
+	if err == nats.ErrKeyNotFound {
+		return eth.Filter{}, 0, &errFilterNotFound
+	} else if err != nil {
+		return eth.Filter{}, 0, errors.Annotate(err, "failed to load filter")
+	}
+
+	filter, err := entry.Value()
+	if err != nil {
+		return eth.Filter{}, 0, errors.Annotate(err, "failed to unmarshal filter")
+	}
+	return filter, entry.Revision(), nil
+}
+
+func filterIdParam(req jsonrpc.Request) (string, error) {
+	var params []string
+	if err := req.UnmarshalParams(&params); err != nil || len(params) != 1 {
+		return "", &jsonrpc.ErrInvalidParams
+	}
+	return params[0], nil
+}
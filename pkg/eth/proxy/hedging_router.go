@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultHedgePercentile is the latency percentile after which a hedged request is sent.
+	DefaultHedgePercentile = 0.95
+
+	// DefaultHedgeMaxLoad is the maximum number of hedged requests as a fraction of all hedgeable requests.
+	DefaultHedgeMaxLoad = 0.1
+
+	// latencySamples is the number of recent latencies per method from which the hedge delay is derived.
+	latencySamples = 128
+
+	// minLatencySamples is the number of samples required before hedging begins for a method.
+	minLatencySamples = 16
+
+	// minHedgeDelay prevents hedging requests which are answered almost immediately.
+	minHedgeDelay = 5 * time.Millisecond
+
+	// maxHedgeTokens bounds the burst of hedged requests allowed by the load cap.
+	maxHedgeTokens = 10
+)
+
+// latencyWindow is a ring buffer of recent request latencies.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	if len(w.samples) < latencySamples {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencySamples
+}
+
+func (w *latencyWindow) percentile(p float64) (time.Duration, bool) {
+	if len(w.samples) < minLatencySamples {
+		return 0, false
+	}
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(p*float64(len(sorted)-1))], true
+}
+
+type hedgeResult struct {
+	resp    jsonrpc.Response
+	err     error
+	latency time.Duration
+	hedged  bool
+}
+
+// HedgingRouter sends a second copy of a request via the delegate if the first has not been answered within
+// a percentile of the recent latencies for the method, and takes whichever answer arrives first. The
+// delegate is expected to choose a different client for the second copy, e.g. as the first is in flight. Only requests
+// for methods with hedging enabled are hedged, and the number of hedged requests is capped as a fraction of
+// the hedgeable requests.
+type HedgingRouter struct {
+	delegate   natsutil.Router
+	percentile float64
+	maxLoad    float64
+
+	mutex     sync.Mutex
+	latencies map[string]*latencyWindow
+	tokens    float64
+
+	log *log.Entry
+}
+
+func NewHedgingRouter(delegate natsutil.Router, percentile float64, maxLoad float64) natsutil.Router {
+	return &HedgingRouter{
+		delegate:   delegate,
+		percentile: percentile,
+		maxLoad:    maxLoad,
+		latencies:  make(map[string]*latencyWindow),
+		log: log.WithFields(log.Fields{
+			"component":  "HedgingRouter",
+			"percentile": percentile,
+			"maxLoad":    maxLoad,
+		}),
+	}
+}
+
+func (r *HedgingRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...natsutil.RouteOpt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.RequestWithContext(ctx, req, resp, options...)
+}
+
+func (r *HedgingRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, options ...natsutil.RouteOpt) error {
+	opts, err := natsutil.BuildRouteOpts(options...)
+	if err != nil {
+		return err
+	}
+
+	if !opts.Hedge {
+		return r.delegate.RequestWithContext(ctx, req, resp, options...)
+	}
+
+	delay, ok := r.hedgeDelay(req.Method)
+
+	// the losing request is cancelled once an answer has been taken
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	send := func(hedged bool) {
+		start := time.Now()
+		result := hedgeResult{hedged: hedged}
+		result.err = r.delegate.RequestWithContext(ctx, req, &result.resp, options...)
+		result.latency = time.Since(start)
+		results <- result
+	}
+
+	go send(false)
+	inFlight := 1
+
+	var timer <-chan time.Time
+	if ok {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	var result hedgeResult
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer:
+			timer = nil
+			if r.takeToken() {
+				r.log.WithFields(log.Fields{
+					"reqMethod": req.Method,
+					"delay":     delay,
+				}).Debug("sending hedged request")
+				hedgedRequestsTotal.WithLabelValues(req.Method).Inc()
+				go send(true)
+				inFlight++
+			}
+			continue
+		case result = <-results:
+			inFlight--
+		}
+
+		if (result.err == nil && result.resp.Error == nil) || inFlight == 0 {
+			break
+		}
+		// the first answer was a failure, wait for the other request
+	}
+
+	if result.err == nil && result.resp.Error == nil && !result.hedged {
+		// hedged latencies would skew the distribution as they start late
+		r.recordLatency(req.Method, result.latency)
+	}
+
+	if result.err != nil {
+		return result.err
+	}
+
+	resp.Result = result.resp.Result
+	resp.Error = result.resp.Error
+	return nil
+}
+
+// hedgeDelay returns the delay after which a request for the method should be hedged, or false if there are
+// not enough samples yet.
+func (r *HedgingRouter) hedgeDelay(method string) (time.Duration, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// every hedgeable request earns a fraction of a hedge
+	r.tokens += r.maxLoad
+	if r.tokens > maxHedgeTokens {
+		r.tokens = maxHedgeTokens
+	}
+
+	window, ok := r.latencies[method]
+	if !ok {
+		return 0, false
+	}
+
+	delay, ok := window.percentile(r.percentile)
+	if delay < minHedgeDelay {
+		delay = minHedgeDelay
+	}
+	return delay, ok
+}
+
+// takeToken consumes a hedge from the load cap, returning false if none are available.
+func (r *HedgingRouter) takeToken() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+func (r *HedgingRouter) recordLatency(method string, latency time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	window, ok := r.latencies[method]
+	if !ok {
+		window = &latencyWindow{}
+		r.latencies[method] = window
+	}
+	window.add(latency)
+}
@@ -2,16 +2,31 @@ package proxy
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/41north/go-jsonrpc"
+	"github.com/41north/tethys/pkg/health"
+	"github.com/41north/tethys/pkg/metrics"
+	"github.com/41north/tethys/pkg/proxy"
 
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
+const (
+	// maxHttpRequestSize constrains the size of a http request body that we are willing to read.
+	maxHttpRequestSize = 5 * 1024 * 1024
+)
+
 var (
 	upgrader = websocket.Upgrader{}
 
@@ -20,13 +35,41 @@ var (
 		Message: "no client available",
 	}
 
+	errUnauthorized = jsonrpc.Error{
+		Code:    -32001,
+		Message: "unauthorized",
+	}
+
+	errApiKeyRequired = jsonrpc.Error{
+		Code:    -32001,
+		Message: "api key required",
+	}
+
+	errInvalidApiKey = jsonrpc.Error{
+		Code:    -32001,
+		Message: "invalid api key",
+	}
+
+	errMethodNotAllowed = jsonrpc.Error{
+		Code:    -32001,
+		Message: "method not allowed for api key",
+	}
+
+	errRateLimited = jsonrpc.Error{
+		Code:    -32005,
+		Message: "request rate limit exceeded",
+	}
+
 	httpErrGroup = new(errgroup.Group)
 	wsErrorGroup = new(errgroup.Group)
 )
 
 func listenAndServe(ctx context.Context, options Options) error {
 	srv := &http.Server{Addr: options.Address}
-	http.HandleFunc("/", requestHandler)
+	http.Handle(metrics.Path, metrics.Handler())
+	health.Register(http.DefaultServeMux, ready(options.MaxHeadAge))
+	http.HandleFunc(StatusPath, statusHandler(options.AdminToken))
+	http.HandleFunc("/", requestHandler(options))
 
 	httpErrGroup.Go(func() error {
 		<-ctx.Done()
@@ -46,13 +89,100 @@ func listenAndServe(ctx context.Context, options Options) error {
 	return httpErrGroup.Wait()
 }
 
-func requestHandler(writer http.ResponseWriter, request *http.Request) {
+func requestHandler(options Options) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		// only upgrade when the client has asked for a websocket
+		if websocket.IsWebSocketUpgrade(request) {
+			wsRequestHandler(writer, request, options)
+			return
+		}
+
+		switch request.Method {
+		case http.MethodPost:
+			httpRequestHandler(writer, request, options)
+		default:
+			writer.Header().Set("Allow", http.MethodPost)
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func wsRequestHandler(writer http.ResponseWriter, request *http.Request, options Options) {
+	apiKeyId, rpcErr := apiKeys.authenticate(request, options.ApiKeysRequired)
+
 	c, err := upgrader.Upgrade(writer, request, nil)
 	if err != nil {
 		log.Print("upgrade:", err)
 		return
 	}
 
-	handler := newWsHandler(c, wsErrorGroup)
+	if rpcErr != nil {
+		// complete the upgrade so the client receives a JSON-RPC error rather than a failed handshake
+		_ = c.WriteJSON(&jsonrpc.Response{Version: "2.0", Error: rpcErr})
+		_ = c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, rpcErr.Message))
+		_ = c.Close()
+		return
+	}
+
+	handler := newWsHandler(c, wsErrorGroup, options.MaxBatchSize, requestScope(request, options.AdminToken), apiKeyId)
 	handler.handle(context.Background())
 }
+
+func httpRequestHandler(writer http.ResponseWriter, request *http.Request, options Options) {
+	l := log.WithFields(log.Fields{
+		"component": "httpHandler",
+		"address":   request.RemoteAddr,
+	})
+
+	apiKeyId, rpcErr := apiKeys.authenticate(request, options.ApiKeysRequired)
+	if rpcErr != nil {
+		writeHttpResponse(writer, &jsonrpc.Response{Version: "2.0", Error: rpcErr}, l)
+		return
+	}
+
+	bytes, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, maxHttpRequestSize))
+	if err != nil {
+		l.WithError(err).Debug("failed to read request body")
+		writeHttpResponse(writer, &jsonrpc.Response{Version: "2.0", Error: &jsonrpc.ErrInvalidRequest}, l)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(proxy.WithScope(request.Context(), requestScope(request, options.AdminToken)), 10*time.Second)
+	defer cancel()
+
+	// continue the trace from the caller, if any
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(request.Header))
+	ctx, span := tracer.Start(ctx, "httpHandler.request", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	writeHttpResponse(writer, handlePayload(ctx, bytes, options.MaxBatchSize, apiKeys.authorize(apiKeyId, invoke)), l)
+}
+
+// requestScope grants the admin scope to requests bearing the admin token, all others are public. Admin
+// methods are unavailable when no admin token has been configured.
+func requestScope(request *http.Request, adminToken string) proxy.Scope {
+	if adminToken == "" {
+		return proxy.ScopePublic
+	}
+
+	header := request.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return proxy.ScopePublic
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		return proxy.ScopePublic
+	}
+
+	return proxy.ScopeAdmin
+}
+
+func writeHttpResponse(writer http.ResponseWriter, resp any, l *log.Entry) {
+	writer.Header().Set("Content-Type", "application/json")
+	// as per the JSON-RPC over HTTP convention, errors are reported in the body with a 200 status code
+	writer.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(writer).Encode(resp); err != nil {
+		l.WithError(err).Error("failed to write json to http response")
+	}
+}
@@ -0,0 +1,359 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	natseth "github.com/41north/tethys/pkg/eth/nats"
+	"github.com/41north/tethys/pkg/eth/tracking"
+	"github.com/41north/tethys/pkg/eth/web3"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// DefaultGetLogsChunkSize is the number of blocks queried per eth_getLogs chunk, in line with common provider limits.
+	DefaultGetLogsChunkSize = 2000
+
+	// DefaultGetLogsParallelism is the number of chunks requested concurrently for a single eth_getLogs request.
+	DefaultGetLogsParallelism = 4
+
+	// maxGetLogsChunks bounds the block range of a single eth_getLogs request.
+	maxGetLogsChunks = 1000
+)
+
+// rangeLimitErrors are fragments of the error messages returned by clients and providers when an eth_getLogs
+// request covers too many blocks or returns too many results. Generic fragments such as "limit exceeded" are
+// avoided as they also match rate limiting errors, which splitting the range would only make worse.
+var rangeLimitErrors = []string{
+	"query returned more than",    // infura, geth based providers
+	"response size exceeded",      // alchemy, generic
+	"block range is too large",    // alchemy, quicknode
+	"exceed maximum block range",  // erigon based providers
+	"range limit exceeded",        // nethermind
+	"query timeout exceeded",      // geth
+	"response size should not be", // ankr
+}
+
+// GetLogsRouter splits the block range of an eth_getLogs filter into chunks which are requested in parallel
+// from clients holding the blocks, using the client selection of the block router. Chunks which hit a provider limit are retried with smaller windows and
+// the results are merged in log order. Chunks which are finalized never change and are cached in the
+// log chunk store.
+type GetLogsRouter struct {
+	chain    *tracking.CanonicalChain
+	delegate *BlockRouter
+
+	chunkStore natseth.LogChunkStore
+
+	chunkSize   uint64
+	parallelism int
+
+	log *log.Entry
+}
+
+// logChunk is the result of requesting logs for a contiguous block range.
+type logChunk struct {
+	logs []json.RawMessage
+	err  error
+}
+
+// logPosition is used for ordering logs when merging chunks.
+type logPosition struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	LogIndex    hexutil.Uint64 `json:"logIndex"`
+}
+
+func NewGetLogsRouter(
+	chain *tracking.CanonicalChain,
+	delegate *BlockRouter,
+	chunkStore natseth.LogChunkStore,
+	chunkSize int,
+	parallelism int,
+) natsutil.Router {
+	return &GetLogsRouter{
+		chain:       chain,
+		delegate:    delegate,
+		chunkStore:  chunkStore,
+		chunkSize:   uint64(chunkSize),
+		parallelism: parallelism,
+		log: log.WithFields(log.Fields{
+			"component":   "GetLogsRouter",
+			"chunkSize":   chunkSize,
+			"parallelism": parallelism,
+		}),
+	}
+}
+
+func (r *GetLogsRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...natsutil.RouteOpt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.RequestWithContext(ctx, req, resp, options...)
+}
+
+func (r *GetLogsRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, options ...natsutil.RouteOpt) error {
+	var params []web3.LogFilter
+	if err := req.UnmarshalParams(&params); err != nil || len(params) != 1 {
+		// let a client report the problem with the params
+		return r.delegate.RequestWithContext(ctx, req, resp, options...)
+	}
+
+	filter := params[0]
+	from, to, ok := filterRange(filter)
+	if !ok {
+		// block hash filters and pending ranges cannot be split
+		return r.delegate.RequestWithContext(ctx, req, resp, options...)
+	}
+
+	if to < from {
+		// nothing to query
+		resp.Result = json.RawMessage("[]")
+		return nil
+	}
+
+	chunks := r.chunks(from, to)
+	if len(chunks) > maxGetLogsChunks {
+		return errors.Errorf("block range too large, a maximum of %d blocks is supported", maxGetLogsChunks*r.chunkSize)
+	}
+
+	results := make([]logChunk, len(chunks))
+	semaphore := make(chan struct{}, r.parallelism)
+
+	var wg sync.WaitGroup
+	for idx, chunk := range chunks {
+		wg.Add(1)
+		go func(idx int, chunk [2]uint64) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			logs, err := r.chunk(ctx, req, filter, chunk[0], chunk[1])
+			results[idx] = logChunk{logs: logs, err: err}
+		}(idx, chunk)
+	}
+	wg.Wait()
+
+	merged := make([]json.RawMessage, 0)
+	for _, result := range results {
+		if result.err != nil {
+			var rpcErr *jsonrpc.Error
+			if errors.As(result.err, &rpcErr) {
+				// surface errors from the client, e.g. invalid params, to the caller
+				resp.Error = rpcErr
+				return nil
+			}
+			return result.err
+		}
+		merged = append(merged, result.logs...)
+	}
+
+	if err := sortLogs(merged); err != nil {
+		return errors.Annotate(err, "failed to merge logs")
+	}
+
+	bytes, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	resp.Result = bytes
+	return nil
+}
+
+// chunks splits the range into windows aligned to the chunk size so that finalized chunks can be re-used
+// across requests with different ranges.
+func (r *GetLogsRouter) chunks(from uint64, to uint64) [][2]uint64 {
+	var result [][2]uint64
+	for start := from; start <= to; {
+		end := (start/r.chunkSize+1)*r.chunkSize - 1
+		if end > to {
+			end = to
+		}
+		result = append(result, [2]uint64{start, end})
+		if len(result) > maxGetLogsChunks {
+			break
+		}
+		start = end + 1
+	}
+	return result
+}
+
+// chunk returns the logs for the block range, from the log chunk store when the range is finalized. Chunks are kept
+// apart from the response store as that bucket is owned by the response cache.
+func (r *GetLogsRouter) chunk(ctx context.Context, req jsonrpc.Request, filter web3.LogFilter, from uint64, to uint64) ([]json.RawMessage, error) {
+	finalized := r.isFinalized(to)
+
+	var key string
+	if finalized {
+		var err error
+		if key, err = chunkKey(filter, from, to); err != nil {
+			return nil, err
+		}
+		if entry, err := r.chunkStore.Get(key); err == nil {
+			if logs, err := entry.Value(); err == nil {
+				return logs, nil
+			}
+		}
+	}
+
+	logs, err := r.request(ctx, req, filter, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if finalized {
+		if _, err := r.chunkStore.Put(key, logs); err != nil {
+			r.log.WithError(err).WithField("key", key).Warn("failed to cache finalized logs")
+		}
+	}
+
+	return logs, nil
+}
+
+// request asks a client for the logs within the block range, halving the window whenever a limit is hit.
+func (r *GetLogsRouter) request(ctx context.Context, req jsonrpc.Request, filter web3.LogFilter, from uint64, to uint64) ([]json.RawMessage, error) {
+	filter.FromBlock = hexutil.EncodeUint64(from)
+	filter.ToBlock = hexutil.EncodeUint64(to)
+
+	params, err := json.Marshal([]web3.LogFilter{filter})
+	if err != nil {
+		return nil, err
+	}
+
+	chunkReq := jsonrpc.Request{Id: req.Id, Method: req.Method, Params: params, Version: req.Version}
+
+	var chunkResp jsonrpc.Response
+	err = r.delegate.requestRange(ctx, chunkReq, &chunkResp, new(big.Int).SetUint64(from), new(big.Int).SetUint64(to))
+	if err != nil {
+		return nil, err
+	}
+
+	if chunkResp.Error != nil {
+		if from == to || !isRangeLimitError(chunkResp.Error) {
+			return nil, chunkResp.Error
+		}
+
+		r.log.WithFields(log.Fields{
+			"from":  from,
+			"to":    to,
+			"error": chunkResp.Error.Message,
+		}).Debug("range limit hit, splitting chunk")
+
+		mid := from + (to-from)/2
+		lower, err := r.request(ctx, req, filter, from, mid)
+		if err != nil {
+			return nil, err
+		}
+		upper, err := r.request(ctx, req, filter, mid+1, to)
+		if err != nil {
+			return nil, err
+		}
+		return append(lower, upper...), nil
+	}
+
+	var logs []json.RawMessage
+	if err = chunkResp.UnmarshalResult(&logs); err != nil {
+		return nil, errors.Annotate(err, "failed to unmarshal logs")
+	}
+	return logs, nil
+}
+
+func (r *GetLogsRouter) isFinalized(number uint64) bool {
+	finalized := r.chain.Finalized()
+	return finalized != nil && finalized.Number.IsUint64() && finalized.Number.Uint64() >= number
+}
+
+// filterRange extracts a concrete block range from the filter. The block tags have already been pinned to
+// numbers by the method transforms, only earliest is left to resolve.
+func filterRange(filter web3.LogFilter) (uint64, uint64, bool) {
+	if filter.BlockHash != "" {
+		return 0, 0, false
+	}
+	from, ok := parseRangeBound(filter.FromBlock)
+	if !ok {
+		return 0, 0, false
+	}
+	to, ok := parseRangeBound(filter.ToBlock)
+	if !ok {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+func parseRangeBound(value string) (uint64, bool) {
+	if value == "earliest" {
+		return 0, true
+	}
+	number, err := hexutil.DecodeUint64(value)
+	return number, err == nil
+}
+
+// chunkKey derives a log chunk store key from the address and topic criteria of the filter and the block range.
+func chunkKey(filter web3.LogFilter, from uint64, to uint64) (string, error) {
+	filter.FromBlock = ""
+	filter.ToBlock = ""
+
+	bytes, err := json.Marshal(filter)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(bytes)
+
+	return natsutil.SubjectName(
+		"eth_getLogs",
+		hexutil.Encode(hasher.Sum(nil)),
+		strconv.FormatUint(from, 10),
+		strconv.FormatUint(to, 10),
+	), nil
+}
+
+func sortLogs(logs []json.RawMessage) error {
+	positions := make([]logPosition, len(logs))
+	for idx, raw := range logs {
+		if err := json.Unmarshal(raw, &positions[idx]); err != nil {
+			return err
+		}
+	}
+
+	sort.Stable(logsByPosition{logs: logs, positions: positions})
+	return nil
+}
+
+type logsByPosition struct {
+	logs      []json.RawMessage
+	positions []logPosition
+}
+
+func (l logsByPosition) Len() int { return len(l.logs) }
+
+func (l logsByPosition) Less(i, j int) bool {
+	if l.positions[i].BlockNumber != l.positions[j].BlockNumber {
+		return l.positions[i].BlockNumber < l.positions[j].BlockNumber
+	}
+	return l.positions[i].LogIndex < l.positions[j].LogIndex
+}
+
+func (l logsByPosition) Swap(i, j int) {
+	l.logs[i], l.logs[j] = l.logs[j], l.logs[i]
+	l.positions[i], l.positions[j] = l.positions[j], l.positions[i]
+}
+
+func isRangeLimitError(err *jsonrpc.Error) bool {
+	message := strings.ToLower(err.Message)
+	for _, fragment := range rangeLimitErrors {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
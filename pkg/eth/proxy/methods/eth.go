@@ -1,9 +1,12 @@
 package methods
 
 import (
+	"time"
+
 	"github.com/41north/tethys/pkg/eth/tracking"
 	natsutil "github.com/41north/tethys/pkg/nats"
 	"github.com/41north/tethys/pkg/proxy"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 const (
@@ -24,35 +27,117 @@ const (
 	EthGetTransactionReceipt               = "eth_getTransactionReceipt"
 	EthGetUncleByBlockHashAndIndex         = "eth_getUncleByBlockHashAndIndex"
 	EthGetUncleByBlockNumberAndIndex       = "eth_getUncleByBlockNumberAndIndex"
+	EthCall                                = "eth_call"
+	EthEstimateGas                         = "eth_estimateGas"
+	EthCreateAccessList                    = "eth_createAccessList"
+	EthGetProof                            = "eth_getProof"
+	EthGetLogs                             = "eth_getLogs"
+	EthFeeHistory                          = "eth_feeHistory"
+	EthGasPrice                            = "eth_gasPrice"
+	EthMaxPriorityFeePerGas                = "eth_maxPriorityFeePerGas"
+	EthChainId                             = "eth_chainId"
+	EthSyncing                             = "eth_syncing"
+	EthSendRawTransaction                  = "eth_sendRawTransaction"
+	EthNewFilter                           = "eth_newFilter"
+	EthNewBlockFilter                      = "eth_newBlockFilter"
+	EthGetFilterChanges                    = "eth_getFilterChanges"
+	EthGetFilterLogs                       = "eth_getFilterLogs"
+	EthUninstallFilter                     = "eth_uninstallFilter"
+
+	// subscription methods are bound to a websocket connection and handled outside the method table
+
+	EthSubscribe    = "eth_subscribe"
+	EthUnsubscribe  = "eth_unsubscribe"
+	EthSubscription = "eth_subscription"
+
+	SubscriptionNewHeads = "newHeads"
+	SubscriptionLogs     = "logs"
 )
 
 func ethMethods(
 	chain *tracking.CanonicalChain,
-	router natsutil.Router,
+	routers Routers,
 ) []proxy.Method {
-	cacheRouteOpt := proxy.RouteOpts(natsutil.CacheRoute(true))
+	router := routers.Default
+
+	// responses for a block number are keyed by the canonical hash by the caching router
+	cacheRouteOpt := proxy.Cache(natsutil.CachePolicy{TTL: 1 * time.Hour})
+
+	// responses for a block hash never change
+	immutableCacheOpt := proxy.Cache(natsutil.CachePolicy{TTL: 24 * time.Hour})
+
+	// transactions and receipts are null until mined and may move to another block on re-org
+	transactionCacheOpt := proxy.Cache(natsutil.CachePolicy{TTL: 24 * time.Hour, NonNullOnly: true, FinalizedOnly: true})
 
-	overrideLatestBlockOpt := func(idx int) proxy.MethodOpt {
-		return proxy.BeforeRequest(proxy.ReplaceParameterByIndex(idx, overrideLatestBlockParam(chain)))
+	// pins block tags to concrete numbers and lets the router know where to find the block parameter
+	blockParamOpt := func(idx int) proxy.MethodOpt {
+		return func(opts *proxy.MethodOpts) error {
+			if err := proxy.BeforeRequest(proxy.ReplaceParameterByIndex(idx, overrideBlockTagParam(chain)))(opts); err != nil {
+				return err
+			}
+			return proxy.RouteOpts(natsutil.BlockParam(idx))(opts)
+		}
 	}
 
+	// as above, but for methods where the block parameter is optional and defaults to latest
+	optionalBlockParamOpt := func(idx int) proxy.MethodOpt {
+		return func(opts *proxy.MethodOpts) error {
+			if err := proxy.BeforeRequest(proxy.DefaultParameterByIndex(idx, LatestBlockParameter))(opts); err != nil {
+				return err
+			}
+			return blockParamOpt(idx)(opts)
+		}
+	}
+
+	// pins the block range tags within a log filter
+	filterOpt := proxy.BeforeRequest(proxy.ReplaceParameterByIndex(0, overrideFilterBlockTags(chain)))
+
+	// lets the router know where to find a block hash param
+	blockHashOpt := proxy.RouteOpts(natsutil.BlockParam(0))
+
+	// indicates the method reads state rather than just block data
+	stateOpt := proxy.RouteOpts(natsutil.RequiresState(true))
+
+	// latency sensitive reads which are safe to send to a second client when slow
+	hedgeOpt := proxy.Hedged()
+
 	return []proxy.Method{
 		proxy.NewMethod(EthBlockNumber, router),
-		proxy.NewMethod(EthGetBalance, router, cacheRouteOpt, overrideLatestBlockOpt(1)),
-		proxy.NewMethod(EthGetStorageAt, router, cacheRouteOpt, overrideLatestBlockOpt(2)),
-		proxy.NewMethod(EthGetBlockByNumber, router, cacheRouteOpt, overrideLatestBlockOpt(0)),
-		proxy.NewMethod(EthGetBlockByHash, router, cacheRouteOpt),
-		proxy.NewMethod(EthGetTransactionCount, router, cacheRouteOpt, overrideLatestBlockOpt(1)),
-		proxy.NewMethod(EthGetBlockTransactionCountByHash, router, cacheRouteOpt),
-		proxy.NewMethod(EthGetBlockTransactionCountByNumber, router, cacheRouteOpt, overrideLatestBlockOpt(0)),
-		proxy.NewMethod(EthGetUncleCountByBlockHash, router, cacheRouteOpt),
-		proxy.NewMethod(EthGetUncleCountByNumber, router, cacheRouteOpt, overrideLatestBlockOpt(0)),
-		proxy.NewMethod(EthGetCode, router, cacheRouteOpt, overrideLatestBlockOpt(1)),
-		proxy.NewMethod(EthGetTransactionByHash, router, cacheRouteOpt),
-		proxy.NewMethod(EthGetTransactionByBlockHashAndIndex, router, cacheRouteOpt),
-		proxy.NewMethod(EthGetTransactionByBlockNumberAndIndex, router, cacheRouteOpt, overrideLatestBlockOpt(0)),
-		proxy.NewMethod(EthGetTransactionReceipt, router, cacheRouteOpt),
-		proxy.NewMethod(EthGetUncleByBlockHashAndIndex, router, cacheRouteOpt),
-		proxy.NewMethod(EthGetUncleByBlockNumberAndIndex, router, cacheRouteOpt, overrideLatestBlockOpt(0)),
+		proxy.NewMethod(EthGetBalance, router, cacheRouteOpt, blockParamOpt(1), stateOpt, hedgeOpt),
+		proxy.NewMethod(EthGetStorageAt, router, cacheRouteOpt, blockParamOpt(2), stateOpt, hedgeOpt),
+		proxy.NewMethod(EthGetBlockByNumber, router, cacheRouteOpt, blockParamOpt(0), hedgeOpt),
+		proxy.NewMethod(EthGetBlockByHash, router, immutableCacheOpt, blockHashOpt, hedgeOpt),
+		proxy.NewMethod(EthGetTransactionCount, router, cacheRouteOpt, blockParamOpt(1), stateOpt, hedgeOpt),
+		proxy.NewMethod(EthGetBlockTransactionCountByHash, router, immutableCacheOpt, blockHashOpt),
+		proxy.NewMethod(EthGetBlockTransactionCountByNumber, router, cacheRouteOpt, blockParamOpt(0)),
+		proxy.NewMethod(EthGetUncleCountByBlockHash, router, immutableCacheOpt, blockHashOpt),
+		proxy.NewMethod(EthGetUncleCountByNumber, router, cacheRouteOpt, blockParamOpt(0)),
+		proxy.NewMethod(EthGetCode, router, cacheRouteOpt, blockParamOpt(1), stateOpt, hedgeOpt),
+		proxy.NewMethod(EthGetTransactionByHash, router, transactionCacheOpt, hedgeOpt),
+		proxy.NewMethod(EthGetTransactionByBlockHashAndIndex, router, immutableCacheOpt, blockHashOpt),
+		proxy.NewMethod(EthGetTransactionByBlockNumberAndIndex, router, cacheRouteOpt, blockParamOpt(0)),
+		proxy.NewMethod(EthGetTransactionReceipt, router, transactionCacheOpt, hedgeOpt),
+		proxy.NewMethod(EthGetUncleByBlockHashAndIndex, router, immutableCacheOpt, blockHashOpt),
+		proxy.NewMethod(EthGetUncleByBlockNumberAndIndex, router, cacheRouteOpt, blockParamOpt(0)),
+		proxy.NewMethod(EthCall, router, cacheRouteOpt, optionalBlockParamOpt(1), stateOpt, hedgeOpt),
+		proxy.NewMethod(EthEstimateGas, router, cacheRouteOpt, optionalBlockParamOpt(1), stateOpt, hedgeOpt),
+		proxy.NewMethod(EthCreateAccessList, router, cacheRouteOpt, optionalBlockParamOpt(1), stateOpt),
+		proxy.NewMethod(EthGetProof, router, cacheRouteOpt, blockParamOpt(2), stateOpt),
+		proxy.NewMethod(EthGetLogs, routers.Logs, filterOpt),
+		proxy.NewMethod(EthFeeHistory, router, cacheRouteOpt, blockParamOpt(1)),
+		// values which change with every block or the mempool are not cached
+		proxy.NewMethod(EthGasPrice, router),
+		proxy.NewMethod(EthMaxPriorityFeePerGas, router),
+		proxy.NewMethod(EthChainId, natsutil.NewStaticResult(hexutil.EncodeUint64(chain.ChainId))),
+		// we only route to clients at the head of the chain
+		proxy.NewMethod(EthSyncing, natsutil.NewStaticResult(false)),
+		// transactions are broadcast to multiple clients so they reliably reach the network
+		proxy.NewMethod(EthSendRawTransaction, routers.Broadcast),
+		// filters are held by the proxy as each request may be routed to a different client
+		proxy.NewMethod(EthNewFilter, routers.Filters),
+		proxy.NewMethod(EthNewBlockFilter, routers.Filters),
+		proxy.NewMethod(EthGetFilterChanges, routers.Filters),
+		proxy.NewMethod(EthGetFilterLogs, routers.Filters),
+		proxy.NewMethod(EthUninstallFilter, routers.Filters),
 	}
 }
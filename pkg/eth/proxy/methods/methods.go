@@ -11,24 +11,81 @@ import (
 type BlockParameter = string
 
 const (
-	LatestBlockParameter   BlockParameter = "latest"
-	EarliestBlockParameter BlockParameter = "earliest"
-	PendingBlockParameter  BlockParameter = "pending"
+	LatestBlockParameter    BlockParameter = "latest"
+	EarliestBlockParameter  BlockParameter = "earliest"
+	PendingBlockParameter   BlockParameter = "pending"
+	SafeBlockParameter      BlockParameter = "safe"
+	FinalizedBlockParameter BlockParameter = "finalized"
 )
 
-func overrideLatestBlockParam(chain *tracking.CanonicalChain) func(any) (any, error) {
+// overrideBlockTagParam pins the latest, safe and finalized block tags to concrete block numbers based on the
+// tracked chain so that every client we route to answers for the same block. The pending tag cannot be pinned
+// and is passed through untouched, as is anything which is not a tag.
+func overrideBlockTagParam(chain *tracking.CanonicalChain) func(any) (any, error) {
 	return func(current any) (any, error) {
-		blockParameter := current.(string)
-		if blockParameter != LatestBlockParameter {
+		blockParameter, ok := current.(string)
+		if !ok {
+			// e.g. an EIP-1898 block hash object, do not override
+			return current, nil
+		}
+
+		switch blockParameter {
+		case LatestBlockParameter:
+			// set the latest block parameter based on the latest tracked head
+			head := chain.Head()
+			if head == nil {
+				return "", errors.New("no head available")
+			}
+			return hexutil.EncodeBig(head.Number), nil
+
+		case SafeBlockParameter:
+			safe := chain.Safe()
+			if safe == nil {
+				return "", errors.New("no safe block available")
+			}
+			return hexutil.EncodeBig(safe.Number), nil
+
+		case FinalizedBlockParameter:
+			finalized := chain.Finalized()
+			if finalized == nil {
+				return "", errors.New("no finalized block available")
+			}
+			return hexutil.EncodeBig(finalized.Number), nil
+
+		default:
 			// do not override
 			return current, nil
 		}
-		// set the latest block parameter based on the latest tracked head
-		head := chain.Head()
-		if head == nil {
-			return "", errors.New("no head available")
+	}
+}
+
+// overrideFilterBlockTags pins the fromBlock and toBlock tags within a log filter object, both of which default
+// to latest when omitted. Filters which specify a block hash are left untouched.
+func overrideFilterBlockTags(chain *tracking.CanonicalChain) func(any) (any, error) {
+	overrideTag := overrideBlockTagParam(chain)
+	return func(current any) (any, error) {
+		filter, ok := current.(map[string]any)
+		if !ok {
+			return current, nil
+		}
+
+		if _, ok := filter["blockHash"]; ok {
+			return current, nil
+		}
+
+		for _, key := range []string{"fromBlock", "toBlock"} {
+			value, ok := filter[key]
+			if !ok || value == nil {
+				value = LatestBlockParameter
+			}
+			pinned, err := overrideTag(value)
+			if err != nil {
+				return current, err
+			}
+			filter[key] = pinned
 		}
-		return hexutil.EncodeBig(head.Number), nil
+
+		return filter, nil
 	}
 }
 
@@ -44,14 +101,28 @@ func register(methodMap map[string]proxy.Method, methods []proxy.Method) error {
 	return nil
 }
 
+// Routers are the routers available to the method table.
+type Routers struct {
+	// Default routes to clients near the head of the chain, with caching and support for historical blocks.
+	Default natsutil.Router
+	// Broadcast sends requests to multiple clients, used for submitting transactions.
+	Broadcast natsutil.Router
+	// Logs splits eth_getLogs block ranges across clients.
+	Logs natsutil.Router
+	// Filters implements the filter methods within the proxy.
+	Filters natsutil.Router
+	// Admin answers the tethys methods from the internal state of the proxy.
+	Admin natsutil.Router
+}
+
 func Build(
 	chain *tracking.CanonicalChain,
-	latestBlockRouter natsutil.Router,
+	routers Routers,
 ) (map[string]proxy.Method, error) {
 	result := make(map[string]proxy.Method)
 
 	// web3 methods
-	if err := register(result, web3Methods(latestBlockRouter)); err != nil {
+	if err := register(result, web3Methods(routers.Default)); err != nil {
 		return nil, err
 	}
 
@@ -61,7 +132,12 @@ func Build(
 	}
 
 	// eth methods
-	if err := register(result, ethMethods(chain, latestBlockRouter)); err != nil {
+	if err := register(result, ethMethods(chain, routers)); err != nil {
+		return nil, err
+	}
+
+	// tethys methods
+	if err := register(result, tethysMethods(routers.Admin)); err != nil {
 		return nil, err
 	}
 
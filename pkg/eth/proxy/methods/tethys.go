@@ -0,0 +1,25 @@
+package methods
+
+import (
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/41north/tethys/pkg/proxy"
+)
+
+const (
+	TethysClients        = "tethys_clients"
+	TethysCanonicalChain = "tethys_canonicalChain"
+	TethysRoutingTable   = "tethys_routingTable"
+	TethysCacheStats     = "tethys_cacheStats"
+)
+
+// tethysMethods expose the internal state of the proxy and are restricted to admins.
+func tethysMethods(router natsutil.Router) []proxy.Method {
+	adminOpt := proxy.RequireScope(proxy.ScopeAdmin)
+
+	return []proxy.Method{
+		proxy.NewMethod(TethysClients, router, adminOpt),
+		proxy.NewMethod(TethysCanonicalChain, router, adminOpt),
+		proxy.NewMethod(TethysRoutingTable, router, adminOpt),
+		proxy.NewMethod(TethysCacheStats, router, adminOpt),
+	}
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/41north/tethys/pkg/eth"
+	"github.com/41north/tethys/pkg/eth/tracking"
+	"github.com/41north/tethys/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/tidwall/btree"
+)
+
+const metricsSubsystem = "proxy"
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "requests_total",
+		Help:      "Number of JSON-RPC requests by method and status.",
+	}, []string{"method", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of JSON-RPC requests by method, including cached responses.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	upstreamRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "upstream_requests_total",
+		Help:      "Number of requests sent to clients by method, client and status.",
+	}, []string{"method", "client", "status"})
+
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of requests sent to clients by method and client.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "client"})
+
+	cacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "cache_requests_total",
+		Help:      "Number of cacheable requests by method and result, either hit or miss.",
+	}, []string{"method", "result"})
+
+	rejectedRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "rejected_requests_total",
+		Help:      "Number of JSON-RPC requests rejected by api key checks by reason.",
+	}, []string{"reason"})
+
+	apiKeyRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "api_key_requests_total",
+		Help:      "Number of JSON-RPC requests accepted by api key name.",
+	}, []string{"key"})
+
+	hedgedRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "hedged_requests_total",
+		Help:      "Number of hedged requests sent by method.",
+	}, []string{"method"})
+
+	clientsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "clients",
+		Help:      "Number of clients within the max distance from head by connection type.",
+	}, []string{"connection_type"})
+
+	breakerStateGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "circuit_breaker_state",
+		Help:      "State of each client's circuit breaker, 0 closed, 1 open and 2 half-open.",
+	}, []string{"client"})
+
+	headNumber = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "canonical_head_number",
+		Help:      "Block number of the canonical head.",
+	})
+
+	// headUpdatedAt is the unix time in nanoseconds when the canonical head last changed
+	headUpdatedAt atomic.Int64
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "canonical_head_age_seconds",
+		Help:      "Time since the canonical head last changed.",
+	}, func() float64 {
+		age, _ := headAge()
+		return age.Seconds()
+	})
+
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "coalesced_requests_total",
+		Help:      "Number of requests served by an identical request already in flight.",
+	}, func() float64 {
+		if coalescingRouter == nil {
+			return 0
+		}
+		return float64(coalescingRouter.Stats().Coalesced)
+	})
+)
+
+// recordClients updates the client counts by connection type.
+func recordClients(clientsByConnection map[eth.ConnectionType]*btree.Set[string]) {
+	for _, connectionType := range eth.ConnectionTypes {
+		count := 0
+		if clientIds, ok := clientsByConnection[connectionType]; ok {
+			count = clientIds.Len()
+		}
+		clientsGauge.WithLabelValues(connectionType.String()).Set(float64(count))
+	}
+}
+
+// recordHeads tracks the number of the canonical head and when it last changed.
+func recordHeads(chain *tracking.CanonicalChain) {
+	updates := make(chan *tracking.CanonicalChain, 32)
+	chain.AddListener(updates)
+
+	go func() {
+		var hash string
+		for update := range updates {
+			head := update.Head()
+			if head == nil || head.BlockHash == hash {
+				continue
+			}
+			hash = head.BlockHash
+			headNumber.Set(float64(head.Number.Uint64()))
+			headUpdatedAt.Store(time.Now().UnixNano())
+		}
+	}()
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	natseth "github.com/41north/tethys/pkg/eth/nats"
+	natsutil "github.com/41north/tethys/pkg/nats"
 
 	"github.com/juju/errors"
 	"github.com/nats-io/nats-server/v2/server"
@@ -61,7 +62,7 @@ func connectNats(opts Options) error {
 		return ErrNatsAlreadyConnected
 	}
 
-	conn, err := nats.Connect(opts.NatsUrl)
+	conn, err := nats.Connect(opts.NatsUrl, natsutil.CountReconnects())
 	if err != nil {
 		return errors.Annotate(err, "failed to connect to NATS")
 	}
@@ -80,8 +81,11 @@ func connectNats(opts Options) error {
 		jsContext,
 		natseth.NetworkAndChainId(opts.NetworkId, opts.ChainId),
 		natseth.Create(true),
+		natseth.ProxyStores(true),
 		natseth.BucketStatusesFormat(opts.BucketClientStatusesFormat),
 		natseth.BucketProfilesFormat(opts.BucketClientProfilesFormat),
+		natseth.BucketFiltersTTL(opts.FilterTimeout),
+		natseth.BucketResponsesTTL(opts.ResponseCacheTTL),
 	)
 
 	if err != nil {
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"math/big"
+
+	"github.com/41north/go-jsonrpc"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// hashLength is the length of a hex encoded 32 byte hash including the 0x prefix.
+	hashLength = 66
+)
+
+// blockParamRef is a reference to a block taken from the request params, either by number or by hash.
+type blockParamRef struct {
+	number *big.Int
+	hash   string
+}
+
+// blockParam extracts a reference to a concrete block from the request params at the given index. Block numbers,
+// block hashes and EIP-1898 objects are supported. It returns false if the param is missing or is a tag such
+// as pending.
+func blockParam(req jsonrpc.Request, idx int) (blockParamRef, bool) {
+	if idx < 0 {
+		return blockParamRef{}, false
+	}
+
+	var params []any
+	if err := req.UnmarshalParams(&params); err != nil || idx >= len(params) {
+		return blockParamRef{}, false
+	}
+
+	switch param := params[idx].(type) {
+	case string:
+		return parseBlockParamString(param)
+	case map[string]any:
+		// EIP-1898
+		if hash, ok := param["blockHash"].(string); ok {
+			return parseBlockParamString(hash)
+		}
+		if number, ok := param["blockNumber"].(string); ok {
+			return parseBlockParamString(number)
+		}
+	}
+
+	return blockParamRef{}, false
+}
+
+func parseBlockParamString(param string) (blockParamRef, bool) {
+	if len(param) == hashLength {
+		return blockParamRef{hash: param}, true
+	}
+	number, err := hexutil.DecodeBig(param)
+	if err != nil {
+		return blockParamRef{}, false
+	}
+	return blockParamRef{number: number}, true
+}
+
+// blockNumberParam extracts a concrete block number from the request params at the given index. It returns
+// false if the param is missing or is not a block number e.g. a tag such as pending.
+func blockNumberParam(req jsonrpc.Request, idx int) (*big.Int, bool) {
+	ref, ok := blockParam(req, idx)
+	if !ok || ref.number == nil {
+		return nil, false
+	}
+	return ref.number, true
+}
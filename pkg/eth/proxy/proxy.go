@@ -3,7 +3,10 @@ package proxy
 import (
 	"context"
 	"net/url"
+	"time"
 
+	"github.com/41north/tethys/pkg/eth/tracking"
+	"github.com/41north/tethys/pkg/tracing"
 	"github.com/juju/errors"
 )
 
@@ -17,6 +20,14 @@ const (
 	DefaultBucketClientStatusFormat   = "eth_%d_%d_client_statuses"
 	DefaultBucketClientProfilesFormat = "eth_%d_%d_client_profiles"
 	DefaultMaxDistanceFromHead        = 3
+	DefaultMaxBatchSize               = 100
+	DefaultForkChoice                 = tracking.ForkChoiceAuto
+	DefaultFilterTimeout              = 5 * time.Minute
+	DefaultResponseCacheTTL           = 24 * time.Hour
+	DefaultTracingEndpoint            = ""
+	DefaultMaxHeadAge                 = time.Minute
+	DefaultAdminToken                 = ""
+	DefaultApiKeysRequired            = false
 )
 
 type Option func(opts *Options) error
@@ -41,6 +52,61 @@ type Options struct {
 	BucketClientProfilesFormat string
 
 	MaxDistanceFromHead int
+
+	// MaxBatchSize constrains the number of requests accepted in a single JSON-RPC batch, 0 means no limit.
+	MaxBatchSize int
+
+	// BroadcastFanOut is the number of clients a raw transaction is sent to, 0 means all healthy clients.
+	BroadcastFanOut int
+
+	// GetLogsChunkSize is the number of blocks requested per chunk when splitting eth_getLogs ranges.
+	GetLogsChunkSize int
+
+	// GetLogsParallelism is the number of eth_getLogs chunks requested concurrently.
+	GetLogsParallelism int
+
+	// FilterTimeout is how long an installed filter is retained without being polled.
+	FilterTimeout time.Duration
+
+	// ResponseCacheTTL is the maximum time a response is retained in the shared store.
+	ResponseCacheTTL time.Duration
+
+	// ConfirmationDepth is the number of blocks below the head after which responses are cached in the shared store.
+	ConfirmationDepth int
+
+	// MaxRetries is the number of other clients a request is sent to after a retryable failure.
+	MaxRetries int
+
+	// RetryableErrors are fragments of JSON-RPC error messages which cause a request to be retried with another client.
+	RetryableErrors []string
+
+	// HedgePercentile is the latency percentile after which a slow request is hedged with a second copy.
+	HedgePercentile float64
+
+	// HedgeMaxLoad is the maximum number of hedged requests as a fraction of all hedgeable requests, 0 disables hedging.
+	HedgeMaxLoad float64
+
+	// BreakerFailureThreshold is the number of consecutive failures after which a client is temporarily removed
+	// from routing, 0 disables the circuit breakers.
+	BreakerFailureThreshold int
+
+	// BreakerOpenTimeout is how long a client is removed from routing before it is probed.
+	BreakerOpenTimeout time.Duration
+
+	// ForkChoice is the name of the strategy used for determining the canonical head.
+	ForkChoice string
+
+	// TracingEndpoint is the OTLP http endpoint to which traces are exported, empty to disable tracing.
+	TracingEndpoint string
+
+	// MaxHeadAge is how long the canonical head can go without changing before the proxy reports it is not ready.
+	MaxHeadAge time.Duration
+
+	// AdminToken is the bearer token which grants access to the tethys admin methods, empty to disable them.
+	AdminToken string
+
+	// ApiKeysRequired rejects requests which do not provide an api key. Keys which are provided are always checked.
+	ApiKeysRequired bool
 }
 
 func Address(addr string) Option {
@@ -99,6 +165,174 @@ func BucketClientProfilesFormat(bucket string) Option {
 	}
 }
 
+func MaxBatchSize(size int) Option {
+	return func(opts *Options) error {
+		if size < 0 {
+			return errors.New("max batch size cannot be negative")
+		}
+		opts.MaxBatchSize = size
+		return nil
+	}
+}
+
+func BroadcastFanOut(fanOut int) Option {
+	return func(opts *Options) error {
+		if fanOut < 0 {
+			return errors.New("broadcast fan out cannot be negative")
+		}
+		opts.BroadcastFanOut = fanOut
+		return nil
+	}
+}
+
+func GetLogsChunkSize(size int) Option {
+	return func(opts *Options) error {
+		if size < 1 {
+			return errors.New("get logs chunk size must be at least 1")
+		}
+		opts.GetLogsChunkSize = size
+		return nil
+	}
+}
+
+func GetLogsParallelism(parallelism int) Option {
+	return func(opts *Options) error {
+		if parallelism < 1 {
+			return errors.New("get logs parallelism must be at least 1")
+		}
+		opts.GetLogsParallelism = parallelism
+		return nil
+	}
+}
+
+func FilterTimeout(timeout time.Duration) Option {
+	return func(opts *Options) error {
+		if timeout <= 0 {
+			return errors.New("filter timeout must be positive")
+		}
+		opts.FilterTimeout = timeout
+		return nil
+	}
+}
+
+func ResponseCacheTTL(ttl time.Duration) Option {
+	return func(opts *Options) error {
+		if ttl <= 0 {
+			return errors.New("response cache ttl must be greater than 0")
+		}
+		opts.ResponseCacheTTL = ttl
+		return nil
+	}
+}
+
+func ConfirmationDepth(depth int) Option {
+	return func(opts *Options) error {
+		if depth < 0 {
+			return errors.New("confirmation depth cannot be negative")
+		}
+		opts.ConfirmationDepth = depth
+		return nil
+	}
+}
+
+func MaxRetries(retries int) Option {
+	return func(opts *Options) error {
+		if retries < 0 {
+			return errors.New("max retries cannot be negative")
+		}
+		opts.MaxRetries = retries
+		return nil
+	}
+}
+
+func RetryableErrors(fragments []string) Option {
+	return func(opts *Options) error {
+		opts.RetryableErrors = fragments
+		return nil
+	}
+}
+
+func HedgePercentile(percentile float64) Option {
+	return func(opts *Options) error {
+		if percentile <= 0 || percentile >= 1 {
+			return errors.New("hedge percentile must be between 0 and 1")
+		}
+		opts.HedgePercentile = percentile
+		return nil
+	}
+}
+
+func HedgeMaxLoad(maxLoad float64) Option {
+	return func(opts *Options) error {
+		if maxLoad < 0 || maxLoad > 1 {
+			return errors.New("hedge max load must be between 0 and 1")
+		}
+		opts.HedgeMaxLoad = maxLoad
+		return nil
+	}
+}
+
+func BreakerFailureThreshold(threshold int) Option {
+	return func(opts *Options) error {
+		if threshold < 0 {
+			return errors.New("breaker failure threshold cannot be negative")
+		}
+		opts.BreakerFailureThreshold = threshold
+		return nil
+	}
+}
+
+func BreakerOpenTimeout(timeout time.Duration) Option {
+	return func(opts *Options) error {
+		if timeout <= 0 {
+			return errors.New("breaker open timeout must be greater than zero")
+		}
+		opts.BreakerOpenTimeout = timeout
+		return nil
+	}
+}
+
+func ForkChoice(name string) Option {
+	return func(opts *Options) error {
+		if _, err := tracking.NewForkChoice(name); err != nil {
+			return err
+		}
+		opts.ForkChoice = name
+		return nil
+	}
+}
+
+func TracingEndpoint(endpoint string) Option {
+	return func(opts *Options) error {
+		opts.TracingEndpoint = endpoint
+		return nil
+	}
+}
+
+func MaxHeadAge(age time.Duration) Option {
+	return func(opts *Options) error {
+		if age <= 0 {
+			return errors.New("max head age must be greater than zero")
+		}
+		opts.MaxHeadAge = age
+		return nil
+	}
+}
+
+func AdminToken(token string) Option {
+	return func(opts *Options) error {
+		opts.AdminToken = token
+		return nil
+	}
+}
+
+func ApiKeysRequired(required bool) Option {
+	return func(opts *Options) error {
+		opts.ApiKeysRequired = required
+		return nil
+	}
+}
+
 func GetDefaultOptions() Options {
 	return Options{
 		Address:                    DefaultAddress,
@@ -110,6 +344,24 @@ func GetDefaultOptions() Options {
 		BucketClientStatusesFormat: DefaultBucketClientStatusFormat,
 		BucketClientProfilesFormat: DefaultBucketClientProfilesFormat,
 		MaxDistanceFromHead:        DefaultMaxDistanceFromHead,
+		MaxBatchSize:               DefaultMaxBatchSize,
+		BroadcastFanOut:            DefaultBroadcastFanOut,
+		GetLogsChunkSize:           DefaultGetLogsChunkSize,
+		GetLogsParallelism:         DefaultGetLogsParallelism,
+		ResponseCacheTTL:           DefaultResponseCacheTTL,
+		FilterTimeout:              DefaultFilterTimeout,
+		ConfirmationDepth:          DefaultConfirmationDepth,
+		MaxRetries:                 DefaultMaxRetries,
+		RetryableErrors:            DefaultRetryableErrors,
+		HedgePercentile:            DefaultHedgePercentile,
+		HedgeMaxLoad:               DefaultHedgeMaxLoad,
+		BreakerFailureThreshold:    DefaultBreakerFailureThreshold,
+		BreakerOpenTimeout:         DefaultBreakerOpenTimeout,
+		ForkChoice:                 DefaultForkChoice,
+		TracingEndpoint:            DefaultTracingEndpoint,
+		MaxHeadAge:                 DefaultMaxHeadAge,
+		AdminToken:                 DefaultAdminToken,
+		ApiKeysRequired:            DefaultApiKeysRequired,
 	}
 }
 
@@ -121,6 +373,17 @@ func ListenAndServe(ctx context.Context, options ...Option) error {
 		}
 	}
 
+	shutdownTracing, err := tracing.Init(ctx, "tethys-proxy", opts.TracingEndpoint)
+	if err != nil {
+		return errors.Annotate(err, "failed to initialise tracing")
+	}
+	defer func() {
+		// the context is done by now, allow time to flush pending spans
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(timeoutCtx)
+	}()
+
 	if err := startNatsServer(opts); err != nil {
 		return errors.Annotate(err, "failed to start NATS server")
 	}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	natseth "github.com/41north/tethys/pkg/eth/nats"
+	"github.com/41north/tethys/pkg/eth/tracking"
+	natsutil "github.com/41north/tethys/pkg/nats"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// publishReorgs publishes the re-org events detected by the canonical chain to the re-orgs stream. Events
+// are de-duplicated by JetStream when multiple proxies detect the same re-org.
+func publishReorgs(js nats.JetStreamContext, chain *tracking.CanonicalChain) error {
+	networkId, chainId := chain.NetworkId, chain.ChainId
+
+	publisher, err := natsutil.NewPublisher[tracking.ReorgEvent](
+		js, natseth.ReorgsSubject(networkId, chainId),
+		func(js nats.JetStreamContext) error {
+			return natseth.EnsureStream(js, natseth.ReorgsStreamConfig(networkId, chainId))
+		},
+	)
+	if err != nil {
+		return errors.Annotate(err, "failed to create re-orgs publisher")
+	}
+
+	l := log.WithFields(log.Fields{
+		"component": "reorgPublisher",
+		"subject":   publisher.Subject,
+	})
+
+	events := make(chan tracking.ReorgEvent, 32)
+	chain.AddReorgListener(events)
+
+	go func() {
+		for event := range events {
+			_, err := publisher.Publish(event, nats.MsgId(natseth.ReorgMsgId(event.OldHead, event.NewHead)))
+			if err != nil {
+				l.WithError(err).WithField("reorg", event).Error("failed to publish re-org event")
+			}
+		}
+	}()
+
+	return nil
+}
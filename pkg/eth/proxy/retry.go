@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/41north/go-jsonrpc"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultMaxRetries is the number of additional clients a request is sent to after a retryable failure.
+	DefaultMaxRetries = 2
+
+	// minRetryWindow is the least amount of time which must remain before the deadline for a retry to be attempted.
+	minRetryWindow = 50 * time.Millisecond
+
+	// minAttemptTimeout is the least amount of time given to an attempt which may be followed by a retry.
+	minAttemptTimeout = 500 * time.Millisecond
+)
+
+// DefaultRetryableErrors are fragments of JSON-RPC error messages which indicate the client was unable to
+// serve the request, typically because it is lagging or has pruned the state, and another client may succeed.
+var DefaultRetryableErrors = []string{
+	"header not found",
+	"missing trie node",
+	"unknown block",
+	"block not found",
+	"required historical state unavailable",
+}
+
+// RetryPolicy determines when a failed request is sent to another client.
+type RetryPolicy struct {
+	// MaxRetries is the budget of additional attempts for each request.
+	MaxRetries int
+	// RetryableErrors are fragments of JSON-RPC error messages which warrant a retry, matched ignoring case.
+	RetryableErrors []string
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:      DefaultMaxRetries,
+		RetryableErrors: DefaultRetryableErrors,
+	}
+}
+
+// shouldRetry determines if the outcome of an attempt warrants trying another client. Transport errors and
+// timeouts, including an attempt exceeding its own timeout, are retried, as are JSON-RPC errors matching the
+// policy. Nothing is retried once the parent context is done.
+func (p RetryPolicy) shouldRetry(ctx context.Context, err error, resp *jsonrpc.Response) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return errors.Is(err, nats.ErrNoResponders) ||
+			errors.Is(err, nats.ErrTimeout) ||
+			errors.Is(err, context.DeadlineExceeded)
+	}
+
+	return p.isRetryableError(resp)
+}
+
+// isRetryableError determines if the JSON-RPC error within the response matches the policy.
+func (p RetryPolicy) isRetryableError(resp *jsonrpc.Response) bool {
+	if resp.Error == nil {
+		return false
+	}
+
+	message := strings.ToLower(resp.Error.Message)
+	for _, fragment := range p.RetryableErrors {
+		if strings.Contains(message, strings.ToLower(fragment)) {
+			return true
+		}
+	}
+	return false
+}
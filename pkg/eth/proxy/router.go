@@ -4,6 +4,7 @@ import (
 	"context"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -22,14 +23,24 @@ import (
 	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/btree"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	canonicalChain    *tracking.CanonicalChain
-	latestBlockRouter natsutil.Router
-	cachingRouter     natsutil.Router
+	latestBlockRouter *LatestBlockRouter
+	cachingRouter     *BlockCachingRouter
+	coalescingRouter  *CoalescingRouter
+	newHeads          *newHeadsFeed
+	apiKeys           *ApiKeys
+	logs              *logsFeed
 
 	proxyMethods map[string]proxy.Method
+
+	tracer = otel.Tracer("github.com/41north/tethys/pkg/eth/proxy")
 )
 
 func InitRouter(opts Options) error {
@@ -40,7 +51,20 @@ func InitRouter(opts Options) error {
 		return errors.Annotate(err, "failed to create client status watcher")
 	}
 
-	canonicalChain, err = tracking.NewCanonicalChain(opts.NetworkId, opts.ChainId, watcher.Updates(), 12)
+	forkChoice, err := tracking.NewForkChoice(opts.ForkChoice)
+	if err != nil {
+		return errors.Annotate(err, "failed to create fork choice")
+	}
+
+	// checkpoints lag the head so more history is required to relate blocks to them
+	maxDistanceFromHead := 12
+	if opts.ForkChoice == tracking.ForkChoiceCheckpoint {
+		maxDistanceFromHead = 96
+	}
+
+	canonicalChain, err = tracking.NewCanonicalChain(
+		opts.NetworkId, opts.ChainId, watcher.Updates(), maxDistanceFromHead, forkChoice,
+	)
 	if err != nil {
 		return errors.Annotate(err, "failed to create canonical chain tracker")
 	}
@@ -51,27 +75,108 @@ func InitRouter(opts Options) error {
 		24*time.Hour,
 	)
 
-	latestBlockRouter = NewLatestBlockRouter(natsConn, canonicalChain, stateManager.Profiles, profileCache, 0)
+	latestBlockRouter = NewLatestBlockRouter(
+		natsConn, canonicalChain, stateManager.Profiles, profileCache, 0,
+		RetryPolicy{MaxRetries: opts.MaxRetries, RetryableErrors: opts.RetryableErrors},
+		opts.BreakerFailureThreshold, opts.BreakerOpenTimeout,
+	)
 
-	canonicalChain.Start()
+	// ensure the new heads stream exists and derive a canonical new heads feed from it
+	if err = natseth.EnsureStream(jsContext, natseth.NewHeadsStreamConfig(opts.NetworkId, opts.ChainId)); err != nil {
+		return errors.Annotate(err, "failed to initialise new heads stream")
+	}
+
+	newHeads, err = newNewHeadsFeed(
+		jsContext,
+		natseth.NewHeadsSubject(opts.NetworkId, opts.ChainId, "*", "*", "*"),
+		canonicalChain,
+	)
+	if err != nil {
+		return errors.Annotate(err, "failed to create new heads feed")
+	}
+
+	// likewise for logs
+	if err = natseth.EnsureStream(jsContext, natseth.LogsStreamConfig(opts.NetworkId, opts.ChainId)); err != nil {
+		return errors.Annotate(err, "failed to initialise logs stream")
+	}
+
+	logs, err = newLogsFeed(
+		jsContext,
+		natseth.LogsSubject(opts.NetworkId, opts.ChainId, "*"),
+		canonicalChain,
+	)
+	if err != nil {
+		return errors.Annotate(err, "failed to create logs feed")
+	}
+
+	recordHeads(canonicalChain)
+
+	if err = publishReorgs(jsContext, canonicalChain); err != nil {
+		return errors.Annotate(err, "failed to initialise re-org publishing")
+	}
+
+	// init the response cache factory, caches are created for each method cache policy as required
+	respCacheFactory := natsutil.NewCacheFactory[jsonrpc.Response](1024*10, stateManager.Responses)
+
+	// route requests for historical blocks to clients which hold them
+	blockRouter := NewBlockRouter(
+		canonicalChain, latestBlockRouter,
+		stateManager.Profiles, profileCache,
+		opts.MaxDistanceFromHead, DefaultStateRetention,
+	)
 
-	// init the response cache
-	respCache := natsutil.NewCache[jsonrpc.Response](
-		1024*10,
-		stateManager.Responses,
-		1*time.Hour,
+	// slow latency sensitive reads are hedged with a second copy sent to another client
+	hedgingRouter := NewHedgingRouter(blockRouter, opts.HedgePercentile, opts.HedgeMaxLoad)
+
+	// identical requests in flight at the same time are only sent once, whether they are cached or not
+	coalescingRouter = NewCoalescingRouter(hedgingRouter)
+
+	// create a caching router backed by the block router
+	cachingRouter = NewBlockCachingRouter(respCacheFactory, canonicalChain, coalescingRouter, opts.ConfirmationDepth)
+
+	// transactions are sent to multiple healthy clients in parallel
+	broadcastRouter := NewBroadcastRouter(
+		natsConn, canonicalChain,
+		stateManager.Profiles, profileCache, stateManager.Transactions, latestBlockRouter.breakers,
+		opts.MaxDistanceFromHead, opts.BroadcastFanOut,
 	)
 
-	// create a caching router backed by the latest block router
-	cachingRouter = natsutil.NewCachingRouter(respCache, stateManager.Responses.Bucket(), latestBlockRouter)
+	// large eth_getLogs ranges are split across clients, falling back to the block router for block hash filters
+	logsRouter := NewGetLogsRouter(
+		canonicalChain, blockRouter, stateManager.LogChunks,
+		opts.GetLogsChunkSize, opts.GetLogsParallelism,
+	)
+
+	apiKeys, err = NewApiKeys(stateManager.ApiKeys)
+	if err != nil {
+		return errors.Annotate(err, "failed to load api keys")
+	}
+
+	// listeners have been registered, start processing client updates
+	canonicalChain.Start()
 
 	// construct a map of supported methods
-	proxyMethods, err = proxymethods.Build(canonicalChain, cachingRouter)
+	proxyMethods, err = proxymethods.Build(canonicalChain, proxymethods.Routers{
+		Default:   cachingRouter,
+		Broadcast: broadcastRouter,
+		Logs:      logsRouter,
+		Filters:   NewFilterRouter(canonicalChain, stateManager.Filters, invoke),
+		Admin:     NewAdminRouter(stateManager, canonicalChain, latestBlockRouter, cachingRouter, coalescingRouter),
+	})
 
 	return err
 }
 
 func closeRouter() {
+	stats := coalescingRouter.Stats()
+	log.WithFields(log.Fields{
+		"requests":  stats.Requests,
+		"coalesced": stats.Coalesced,
+	}).Info("request coalescing stats")
+
+	apiKeys.Close()
+	newHeads.close()
+	logs.close()
 	canonicalChain.Close()
 }
 
@@ -82,12 +187,42 @@ func invoke(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response) {
 
 	// check if the method is supported
 	method, ok := proxyMethods[req.Method]
+
+	// unsupported methods share a label to bound the cardinality of the metrics
+	methodLabel := req.Method
+	if !ok {
+		methodLabel = "unsupported"
+	}
+
+	ctx, span := tracer.Start(ctx, "proxy.invoke",
+		trace.WithAttributes(attribute.String("rpc.method", methodLabel)),
+	)
+
+	start := time.Now()
+	defer func() {
+		status := natsutil.RequestStatus(nil, resp)
+		requestDuration.WithLabelValues(methodLabel).Observe(time.Since(start).Seconds())
+		requestsTotal.WithLabelValues(methodLabel, status).Inc()
+
+		span.SetAttributes(attribute.String("rpc.status", status))
+		if resp.Error != nil {
+			span.SetStatus(codes.Error, resp.Error.Message)
+		}
+		span.End()
+	}()
+
 	if !ok {
 		// todo make a const error for this
 		errorResponse(errors.New("method not supported"), resp)
 		return
 	}
 
+	if !proxy.ScopeFromContext(ctx).Allows(method.Scope()) {
+		rpcErr := errUnauthorized
+		resp.Error = &rpcErr
+		return
+	}
+
 	var err error
 	req, err = method.BeforeRequest(req)
 	if err != nil {
@@ -148,12 +283,18 @@ type LatestBlockRouter struct {
 
 	subjectPrefix string
 
-	clientIdx      atomic.Uint64
+	selector       *ClientSelector
 	currentClients atomic.Value
 
 	profileStore natseth.ProfileStore
 	profileCache cache.Cache
 
+	retryPolicy RetryPolicy
+	breakers    *CircuitBreakers
+
+	// serialises updates of the current clients from chain updates and breaker changes
+	updateMutex sync.Mutex
+
 	log *log.Entry
 }
 
@@ -163,7 +304,10 @@ func NewLatestBlockRouter(
 	profileStore natseth.ProfileStore,
 	profileCache cache.Cache,
 	maxDistanceFromHead int,
-) natsutil.Router {
+	retryPolicy RetryPolicy,
+	breakerFailureThreshold int,
+	breakerOpenTimeout time.Duration,
+) *LatestBlockRouter {
 	subjectPrefix := natsutil.SubjectName(
 		"eth", "rpc",
 		strconv.FormatUint(chain.NetworkId, 10),
@@ -177,12 +321,21 @@ func NewLatestBlockRouter(
 		subjectPrefix:       subjectPrefix,
 		profileStore:        profileStore,
 		profileCache:        profileCache,
+		retryPolicy:         retryPolicy,
+		selector:            NewClientSelector(),
 		log: log.WithFields(log.Fields{
 			"component":           "LatestBlockRouter(latest)",
 			"maxDistanceFromHead": maxDistanceFromHead,
 		}),
 	}
 
+	// clients are removed from or returned to routing as their breakers change
+	router.breakers = NewCircuitBreakers(
+		conn, subjectPrefix,
+		breakerFailureThreshold, breakerOpenTimeout,
+		func() { router.onUpdate(chain) },
+	)
+
 	chainUpdates := make(chan *tracking.CanonicalChain, 32)
 	chain.AddListener(chainUpdates)
 
@@ -191,12 +344,39 @@ func NewLatestBlockRouter(
 	return router
 }
 
+// BreakerStates returns the state of the circuit breaker for each client which has one.
+func (r *LatestBlockRouter) BreakerStates() map[string]BreakerState {
+	return r.breakers.States()
+}
+
+// RoutingTable returns the connection type currently preferred and the clients eligible for routing by
+// connection type.
+func (r *LatestBlockRouter) RoutingTable() (eth.ConnectionType, map[eth.ConnectionType][]string) {
+	result := make(map[eth.ConnectionType][]string)
+
+	currentClientsRef := r.currentClients.Load()
+	if currentClientsRef == nil {
+		return -1, result
+	}
+
+	current := currentClientsRef.(currentClients)
+	for connectionType, clientIds := range current.clientsByConnection {
+		result[connectionType] = clientIds.Keys()
+	}
+	return current.connectionType, result
+}
+
 func (r *LatestBlockRouter) getClientProfile(id string) (*eth.ClientProfile, error) {
+	return getClientProfile(r.profileStore, r.profileCache, id)
+}
+
+// getClientProfile loads a client profile via the cache, falling back to the profile store.
+func getClientProfile(profileStore natseth.ProfileStore, profileCache cache.Cache, id string) (*eth.ClientProfile, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	var profile eth.ClientProfile
-	err := r.profileCache.GetByFunc(ctx, r.profileStore.Bucket(), id, &profile, func() (interface{}, error) {
-		entry, err := r.profileStore.Get(id)
+	err := profileCache.GetByFunc(ctx, profileStore.Bucket(), id, &profile, func() (interface{}, error) {
+		entry, err := profileStore.Get(id)
 		if err != nil {
 			return nil, err
 		}
@@ -231,17 +411,25 @@ func (r *LatestBlockRouter) listenForUpdates(updates <-chan *tracking.CanonicalC
 }
 
 func (r *LatestBlockRouter) onUpdate(chain *tracking.CanonicalChain) {
+	r.updateMutex.Lock()
+	defer r.updateMutex.Unlock()
+
 	clientsByConnection := make(map[eth.ConnectionType]*btree.Set[string])
 
 	head := chain.Head()
 	distanceFromHead := 0
 
 	for head != nil && distanceFromHead <= r.maxDistanceFromHead {
-		head.ClientIds.Scan(func(clientId string) bool {
+		for _, clientId := range chain.ClientIds(head) {
+			if !r.breakers.Allow(clientId) {
+				// temporarily removed until the client has recovered
+				continue
+			}
+
 			profile, err := r.getClientProfile(clientId)
 			if err != nil {
 				r.log.WithError(err).WithField("clientId", clientId).Error("failed to load client profile")
-				return true
+				continue
 			}
 
 			clientIds, ok := clientsByConnection[profile.ConnectionType]
@@ -251,8 +439,7 @@ func (r *LatestBlockRouter) onUpdate(chain *tracking.CanonicalChain) {
 			}
 
 			clientIds.Insert(clientId)
-			return true
-		})
+		}
 
 		head, _ = chain.BlockByHash(head.ParentHash)
 		distanceFromHead += 1
@@ -280,27 +467,39 @@ func (r *LatestBlockRouter) onUpdate(chain *tracking.CanonicalChain) {
 		r.currentClients.Store(update)
 	}
 
+	recordClients(clientsByConnection)
+
 	r.log.WithField("clients", update).Debug("processed update")
 }
 
-func (r *LatestBlockRouter) nextSubject() (string, error) {
+// latestCandidates returns the clients within the max distance from head which pass the filter.
+func (r *LatestBlockRouter) latestCandidates(filter func(clientId string) bool) []string {
 	currentClientsRef := r.currentClients.Load()
 	if currentClientsRef == nil {
-		return "", natsutil.ErrNoClientsAvailable
+		return nil
 	}
 
-	currentClients := currentClientsRef.(currentClients)
-	clientIds := currentClients.clientIds()
-
-	nextIdx := r.clientIdx.Add(1)
-	nextIdx = nextIdx % uint64(clientIds.Len())
+	var candidates []string
+	currentClientsRef.(currentClients).clientIds().Scan(func(clientId string) bool {
+		if filter == nil || filter(clientId) {
+			candidates = append(candidates, clientId)
+		}
+		return true
+	})
+	return candidates
+}
 
-	clientId, ok := clientIds.GetAt(int(nextIdx))
-	if !ok {
-		return "", natsutil.ErrNoClientsAvailable
+// selectClient chooses between the candidates which have not been attempted and whose breaker is closed, also
+// returning how many of the other eligible clients remain for a retry.
+func (r *LatestBlockRouter) selectClient(candidates []string, attempted map[string]bool) (string, int, bool) {
+	var eligible []string
+	for _, clientId := range candidates {
+		if !attempted[clientId] && r.breakers.Allow(clientId) {
+			eligible = append(eligible, clientId)
+		}
 	}
-
-	return natsutil.SubjectName(r.subjectPrefix, clientId), nil
+	clientId, ok := r.selector.Select(eligible)
+	return clientId, len(eligible) - 1, ok
 }
 
 func (r *LatestBlockRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...natsutil.RouteOpt) error {
@@ -309,10 +508,119 @@ func (r *LatestBlockRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response,
 	return r.RequestWithContext(ctx, req, resp, options...)
 }
 
-func (r *LatestBlockRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, _ ...natsutil.RouteOpt) error {
-	subject, err := r.nextSubject()
+func (r *LatestBlockRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, options ...natsutil.RouteOpt) error {
+	opts, err := natsutil.BuildRouteOpts(options...)
 	if err != nil {
 		return err
 	}
-	return r.conn.RequestWithContext(ctx, subject, req, resp)
+
+	number, hasBlock := blockNumberParam(req, opts.BlockParamIdx)
+
+	// only route to clients which have the requested block
+	return r.requestFrom(ctx, req, resp, func() []string {
+		return r.latestCandidates(func(clientId string) bool {
+			if !hasBlock {
+				return true
+			}
+			state, ok := r.chain.Client(clientId)
+			return ok && state.HasBlock(number)
+		})
+	})
+}
+
+// requestFrom sends the request to one of the candidates, retrying with the others according to the retry
+// policy. Candidates are re-evaluated before each attempt.
+func (r *LatestBlockRouter) requestFrom(
+	ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, candidates func() []string,
+) error {
+	attempted := make(map[string]bool)
+
+	// the transport error from the previous attempt, a JSON-RPC error remains in the response
+	var lastErr error
+
+	for attempt := 0; ; attempt++ {
+		clientId, alternatives, ok := r.selectClient(candidates(), attempted)
+		if !ok {
+			if attempt > 0 {
+				// every eligible client has been attempted, report the last failure
+				return lastErr
+			}
+			return natsutil.ErrNoClientsAvailable
+		}
+		attempted[clientId] = true
+		subject := natsutil.SubjectName(r.subjectPrefix, clientId)
+
+		retriesLeft := r.retryPolicy.MaxRetries - attempt
+
+		// an attempt which may be followed by a retry is bounded so that a client which hangs leaves time for
+		// another client, the last attempt uses whatever time remains
+		attemptCtx, cancel := attemptContext(ctx, retriesLeft > 0 && alternatives > 0)
+		attemptCtx, span := tracer.Start(attemptCtx, "LatestBlockRouter.attempt",
+			trace.WithAttributes(
+				attribute.String("client.id", clientId),
+				attribute.Int("attempt", attempt),
+			),
+		)
+
+		// clear the outcome of any previous attempt
+		resp.Result, resp.Error = nil, nil
+		done := r.selector.Begin(clientId)
+		start := time.Now()
+		err := natsutil.Request(attemptCtx, r.conn, subject, req, resp)
+		span.End()
+		cancel()
+
+		// a request cancelled by the caller, e.g. a hedged request which lost, or which ran out of the caller's
+		// time says nothing about the client, whereas exceeding the attempt timeout counts against it
+		record := err == nil || ctx.Err() == nil
+		failed := err != nil || r.retryPolicy.isRetryableError(resp)
+		done(record, failed)
+
+		status := "cancelled"
+		if record {
+			r.breakers.Record(clientId, failed)
+			status = natsutil.RequestStatus(err, resp)
+			upstreamDuration.WithLabelValues(req.Method, clientId).Observe(time.Since(start).Seconds())
+		}
+		upstreamRequestsTotal.WithLabelValues(req.Method, clientId, status).Inc()
+
+		if retriesLeft == 0 || !r.retryPolicy.shouldRetry(ctx, err, resp) || !hasTimeForRetry(ctx) {
+			return err
+		}
+
+		l := r.log.WithFields(log.Fields{
+			"clientId":  clientId,
+			"reqMethod": req.Method,
+			"attempt":   attempt,
+		})
+		if err != nil {
+			l = l.WithError(err)
+		} else {
+			l = l.WithField("rpcError", resp.Error.Message)
+		}
+		l.Debug("request failed, retrying with another client")
+
+		lastErr = err
+	}
+}
+
+// attemptContext bounds an attempt which may be retried to half of the time remaining before the deadline, but
+// never less than minAttemptTimeout, so that the first attempt is favoured whilst a hung client can be retried.
+func attemptContext(ctx context.Context, retryable bool) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !retryable || !ok {
+		return context.WithCancel(ctx)
+	}
+
+	timeout := time.Until(deadline) / 2
+	if timeout < minAttemptTimeout {
+		timeout = minAttemptTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// hasTimeForRetry determines if enough time remains before the deadline for another attempt.
+func hasTimeForRetry(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > minRetryWindow
 }
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/41north/tethys/pkg/eth"
+	"github.com/41north/tethys/pkg/eth/tracking"
+	"github.com/41north/tethys/pkg/health"
+	"github.com/41north/tethys/pkg/proxy"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// StatusPath serves a json view of the canonical chain, and of the clients being tracked when the admin
+	// token is provided.
+	StatusPath = "/status"
+)
+
+type clientStatus struct {
+	Id             string              `json:"id"`
+	ConnectionType *eth.ConnectionType `json:"connectionType,omitempty"`
+	Head           *tracking.BlockRef  `json:"head,omitempty"`
+	// Lag is the number of blocks the client's head is behind the canonical head.
+	Lag     *big.Int `json:"lag,omitempty"`
+	Breaker string   `json:"breaker"`
+}
+
+type status struct {
+	Head      *tracking.BlockRef `json:"head,omitempty"`
+	HeadAge   string             `json:"headAge,omitempty"`
+	Safe      *tracking.BlockRef `json:"safe,omitempty"`
+	Finalized *tracking.BlockRef `json:"finalized,omitempty"`
+	Clients   []clientStatus     `json:"clients,omitempty"`
+}
+
+// headAge returns the time since the canonical head last changed, or false if there has not been a head yet.
+func headAge() (time.Duration, bool) {
+	updatedAt := headUpdatedAt.Load()
+	if updatedAt == 0 {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, updatedAt)), true
+}
+
+// ready reports the proxy as ready whilst it is connected to NATS and the canonical head has changed within
+// the max head age.
+func ready(maxHeadAge time.Duration) health.Check {
+	return func() error {
+		if natsConn == nil || !natsConn.Conn.IsConnected() {
+			return errors.New("not connected to NATS")
+		}
+		if canonicalChain == nil || canonicalChain.Head() == nil {
+			return errors.New("no canonical head")
+		}
+		if age, ok := headAge(); !ok || age > maxHeadAge {
+			return errors.Errorf("canonical head is stale, last updated %v ago", age.Round(time.Second))
+		}
+		return nil
+	}
+}
+
+// statusHandler serves the status, the clients are only included for callers with the admin scope as they
+// reveal the same details as the tethys admin methods.
+func statusHandler(adminToken string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var result status
+
+		if canonicalChain != nil {
+			result = buildStatus(requestScope(request, adminToken).Allows(proxy.ScopeAdmin))
+		}
+
+		writeStatus(writer, result)
+	}
+}
+
+func writeStatus(writer http.ResponseWriter, result status) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(writer).Encode(result); err != nil {
+		log.WithError(err).Error("failed to write status to http response")
+	}
+}
+
+func buildStatus(includeClients bool) status {
+	result := status{
+		Safe:      canonicalChain.Safe(),
+		Finalized: canonicalChain.Finalized(),
+	}
+
+	head := canonicalChain.Head()
+	if head != nil {
+		result.Head = &tracking.BlockRef{Number: head.Number, BlockHash: head.BlockHash}
+	}
+	if age, ok := headAge(); ok {
+		result.HeadAge = age.Round(time.Millisecond).String()
+	}
+
+	if !includeClients {
+		return result
+	}
+
+	result.Clients = []clientStatus{}
+	breakers := latestBlockRouter.BreakerStates()
+
+	for _, state := range canonicalChain.Clients() {
+		client := clientStatus{
+			Id:      state.Id,
+			Head:    state.Head,
+			Breaker: breakers[state.Id].String(),
+		}
+
+		if profile, err := latestBlockRouter.getClientProfile(state.Id); err == nil {
+			client.ConnectionType = &profile.ConnectionType
+		}
+
+		if head != nil && state.Head != nil {
+			client.Lag = new(big.Int).Sub(head.Number, state.Head.Number)
+		}
+
+		result.Clients = append(result.Clients, client)
+	}
+
+	sort.Slice(result.Clients, func(i, j int) bool {
+		return result.Clients[i].Id < result.Clients[j].Id
+	})
+
+	return result
+}
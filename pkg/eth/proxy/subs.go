@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/41north/go-jsonrpc"
+	proxymethods "github.com/41north/tethys/pkg/eth/proxy/methods"
+	"github.com/41north/tethys/pkg/eth/web3"
+	"github.com/juju/errors"
+)
+
+const (
+	// subscriptionBufferSize is the number of notifications buffered per subscription.
+	subscriptionBufferSize = 64
+)
+
+type subscriptionNotification struct {
+	Version string                        `json:"jsonrpc"`
+	Method  string                        `json:"method"`
+	Params  web3.SubscriptionNotification `json:"params"`
+}
+
+// wsSubscriptions tracks the subscriptions created over a single websocket connection.
+type wsSubscriptions struct {
+	mutex        sync.Mutex
+	unsubscribes map[string]func() bool
+	// closed is set once the connection is closing, after which no further subscriptions are accepted
+	closed bool
+}
+
+func newWsSubscriptions() *wsSubscriptions {
+	return &wsSubscriptions{
+		unsubscribes: make(map[string]func() bool),
+	}
+}
+
+// add tracks a subscription, returning false and unsubscribing immediately if the connection is already closing
+// so that a subscription created by an in-flight request is not leaked.
+func (s *wsSubscriptions) add(id string, unsubscribe func() bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		unsubscribe()
+		return false
+	}
+	s.unsubscribes[id] = unsubscribe
+	return true
+}
+
+func (s *wsSubscriptions) remove(id string) bool {
+	s.mutex.Lock()
+	unsubscribe, ok := s.unsubscribes[id]
+	delete(s.unsubscribes, id)
+	s.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+	return unsubscribe()
+}
+
+func (s *wsSubscriptions) removeAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	for id, unsubscribe := range s.unsubscribes {
+		delete(s.unsubscribes, id)
+		unsubscribe()
+	}
+}
+
+// invoke intercepts subscription related requests which are bound to the websocket connection and
+// passes everything else through to the method table.
+func (h *wsHandler) invoke(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response) {
+	switch req.Method {
+	case proxymethods.EthSubscribe:
+		resp.Id = req.Id
+		resp.Version = "2.0"
+		if err := h.subscribe(req, resp); err != nil {
+			errorResponse(err, resp)
+		}
+	case proxymethods.EthUnsubscribe:
+		resp.Id = req.Id
+		resp.Version = "2.0"
+		if err := h.unsubscribe(req, resp); err != nil {
+			errorResponse(err, resp)
+		}
+	default:
+		invoke(ctx, req, resp)
+	}
+}
+
+func (h *wsHandler) subscribe(req jsonrpc.Request, resp *jsonrpc.Response) error {
+	var params []json.RawMessage
+	if err := req.UnmarshalParams(&params); err != nil || len(params) == 0 {
+		return errors.New("invalid subscription params")
+	}
+
+	var kind string
+	if err := json.Unmarshal(params[0], &kind); err != nil {
+		return errors.New("invalid subscription type")
+	}
+
+	ch := make(chan json.RawMessage, subscriptionBufferSize)
+
+	var id string
+	var unsubscribe func() bool
+
+	switch kind {
+	case proxymethods.SubscriptionNewHeads:
+		id = newHeads.subscribe(ch)
+		unsubscribe = func() bool { return newHeads.unsubscribe(id) }
+	case proxymethods.SubscriptionLogs:
+		var filter web3.LogFilter
+		if len(params) > 1 {
+			if err := json.Unmarshal(params[1], &filter); err != nil {
+				return errors.Annotate(err, "invalid logs filter")
+			}
+		}
+		id = logs.subscribe(filter, ch)
+		unsubscribe = func() bool { return logs.unsubscribe(id) }
+	default:
+		return errors.Errorf("unsupported subscription type: %s", kind)
+	}
+
+	if !h.subs.add(id, unsubscribe) {
+		return errors.New("connection is closing")
+	}
+	h.forward(id, ch)
+
+	result, err := json.Marshal(id)
+	if err != nil {
+		return errors.Annotate(err, "failed to marshal subscription id")
+	}
+	resp.Result = result
+	return nil
+}
+
+func (h *wsHandler) unsubscribe(req jsonrpc.Request, resp *jsonrpc.Response) error {
+	var params []string
+	if err := req.UnmarshalParams(&params); err != nil || len(params) == 0 {
+		return errors.New("invalid unsubscribe params")
+	}
+
+	result, err := json.Marshal(h.subs.remove(params[0]))
+	if err != nil {
+		return errors.Annotate(err, "failed to marshal unsubscribe result")
+	}
+	resp.Result = result
+	return nil
+}
+
+// forward writes each result received on the channel to the websocket as a subscription notification
+// until the channel is closed.
+func (h *wsHandler) forward(id string, ch <-chan json.RawMessage) {
+	h.inFlight.Add(1)
+	go func() {
+		defer h.inFlight.Done()
+		for result := range ch {
+			h.respCh <- &subscriptionNotification{
+				Version: "2.0",
+				Method:  proxymethods.EthSubscription,
+				Params: web3.SubscriptionNotification{
+					SubscriptionId: id,
+					Result:         result,
+				},
+			}
+		}
+	}()
+}
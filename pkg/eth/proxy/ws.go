@@ -2,28 +2,42 @@ package proxy
 
 import (
 	"context"
-	"encoding/json"
+	"sync"
 	"time"
 
-	"github.com/41north/go-jsonrpc"
-
+	"github.com/41north/tethys/pkg/proxy"
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
 type wsHandler struct {
-	log    *log.Entry
-	conn   *websocket.Conn
-	group  *errgroup.Group
-	respCh chan *jsonrpc.Response
+	log          *log.Entry
+	conn         *websocket.Conn
+	group        *errgroup.Group
+	respCh       chan any
+	inFlight     *sync.WaitGroup
+	subs         *wsSubscriptions
+	maxBatchSize int
+	// scope is granted to every request on the connection
+	scope proxy.Scope
+	// apiKeyId identifies the api key the connection was opened with, empty for anonymous connections
+	apiKeyId string
 }
 
-func newWsHandler(conn *websocket.Conn, group *errgroup.Group) wsHandler {
+func newWsHandler(
+	conn *websocket.Conn, group *errgroup.Group, maxBatchSize int, scope proxy.Scope, apiKeyId string,
+) wsHandler {
 	return wsHandler{
-		conn:   conn,
-		group:  group,
-		respCh: make(chan *jsonrpc.Response, 256),
+		conn:         conn,
+		group:        group,
+		scope:        scope,
+		apiKeyId:     apiKeyId,
+		respCh:       make(chan any, 256),
+		inFlight:     &sync.WaitGroup{},
+		subs:         newWsSubscriptions(),
+		maxBatchSize: maxBatchSize,
 		log: log.WithFields(log.Fields{
 			"component": "wsHandler",
 			"address":   conn.UnderlyingConn().RemoteAddr().String(),
@@ -44,6 +58,9 @@ func (h *wsHandler) socketWrite() error {
 			switch err.(type) {
 
 			case *websocket.CloseError:
+				// keep draining so that writers are not blocked
+				for range h.respCh {
+				}
 				return err
 
 			default:
@@ -54,39 +71,41 @@ func (h *wsHandler) socketWrite() error {
 	return nil
 }
 
+// closeResponses cancels any subscriptions and waits for in-flight requests to complete before closing
+// the response channel.
+func (h *wsHandler) closeResponses() {
+	h.subs.removeAll()
+	h.inFlight.Wait()
+	close(h.respCh)
+}
+
 func (h *wsHandler) socketRead(ctx context.Context) error {
 	for {
 		select {
 
 		case <-ctx.Done():
-			close(h.respCh)
+			h.closeResponses()
 			return nil
 
 		default:
 
 			_, bytes, err := h.conn.ReadMessage()
 			if err != nil {
-				close(h.respCh)
+				h.closeResponses()
 				return err
 			}
 
-			var req jsonrpc.Request
-			if err = json.Unmarshal(bytes, &req); err != nil {
-				h.respCh <- &jsonrpc.Response{
-					Error: &jsonrpc.ErrParse,
-				}
-				continue
-			}
-
+			h.inFlight.Add(1)
 			go func() {
-				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer h.inFlight.Done()
+
+				ctx, cancel := context.WithTimeout(proxy.WithScope(context.Background(), h.scope), 10*time.Second)
 				defer cancel()
 
-				resp := &jsonrpc.Response{}
-				defer func() { h.respCh <- resp }()
+				ctx, span := tracer.Start(ctx, "wsHandler.message", trace.WithSpanKind(trace.SpanKindServer))
+				defer span.End()
 
-				invoke(ctx, req, resp)
-				h.respCh <- resp
+				h.respCh <- handlePayload(ctx, bytes, h.maxBatchSize, apiKeys.authorize(h.apiKeyId, h.invoke))
 			}()
 		}
 	}
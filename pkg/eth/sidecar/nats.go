@@ -1,6 +1,9 @@
 package sidecar
 
 import (
+	"sync/atomic"
+
+	natsutil "github.com/41north/tethys/pkg/nats"
 	"github.com/juju/errors"
 	"github.com/nats-io/nats.go"
 )
@@ -8,12 +11,15 @@ import (
 var (
 	natsConn *nats.EncodedConn
 	natsJs   nats.JetStreamContext
+
+	// sessionReady indicates a client session is connected and has published the client status
+	sessionReady atomic.Bool
 )
 
 func connectNats(opts Options) error {
 	var err error
 
-	conn, err := nats.Connect(opts.NatsUrl)
+	conn, err := nats.Connect(opts.NatsUrl, natsutil.CountReconnects())
 	if err != nil {
 		return errors.Annotate(err, "failed to connect to NATS")
 	}
@@ -31,6 +37,18 @@ func connectNats(opts Options) error {
 	return nil
 }
 
+// ready reports the sidecar as ready once a session has connected to the web3 client and published its
+// status, and whilst the connection to NATS is up.
+func ready() error {
+	if natsConn == nil || !natsConn.Conn.IsConnected() {
+		return errors.New("not connected to NATS")
+	}
+	if !sessionReady.Load() {
+		return errors.New("web3 client session is not established")
+	}
+	return nil
+}
+
 func closeNats() {
 	natsConn.Close()
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	natseth "github.com/41north/tethys/pkg/eth/nats"
@@ -18,9 +19,16 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+const (
+	// checkpointPollInterval is how often the safe and finalized blocks are retrieved from the client, which
+	// matches the slot time as they cannot change more frequently than that.
+	checkpointPollInterval = 12 * time.Second
+)
+
 type clientSession struct {
 	url            string
 	connectionType eth.ConnectionType
+	syncMode       eth.SyncMode
 	clientId       *string
 	log            *log.Entry
 
@@ -33,8 +41,10 @@ type clientSession struct {
 
 	clientProfile *eth.ClientProfile
 	clientStatus  *eth.ClientStatus
+	statusMutex   sync.Mutex
 
 	newHeadsPublisher *natsutil.Publisher[web3.NewHead]
+	logsPublisher     *natsutil.Publisher[web3.Log]
 
 	subscriptionIds []string
 
@@ -45,6 +55,7 @@ func newClientSession(opts Options) clientSession {
 	return clientSession{
 		url:            opts.ClientUrl,
 		connectionType: opts.ClientConnectionType,
+		syncMode:       opts.ClientSyncMode,
 		clientId:       opts.ClientId,
 		log: log.WithFields(log.Fields{
 			"component": "ClientSession",
@@ -143,17 +154,35 @@ func (cs *clientSession) connect(ctx context.Context) error {
 		return errors.Annotate(err, "failed to subscribe to new heads")
 	}
 
+	// subscribe and publish logs
+	if err = cs.buildLogsPublisher(); err != nil {
+		return errors.Annotate(err, "failed to build logs publisher")
+	}
+
+	if err = cs.subscribeToLogs(sessionCtx); err != nil {
+		return errors.Annotate(err, "failed to subscribe to logs")
+	}
+
+	// track the safe and finalized blocks
+	cs.group.Go(func() error {
+		cs.pollCheckpoints(sessionCtx)
+		return nil
+	})
+
 	// start listening for rpc requests from NATS
 	cs.group.Go(func() error {
 		return cs.listenForRpcRequests(sessionCtx)
 	})
 
+	sessionReady.Store(true)
+
 	// wait for cancellation or downstream disconnection
 	select {
 	case <-ctx.Done():
 	case <-closeCh:
 	}
 
+	sessionReady.Store(false)
 	cs.log.Debug("stopping")
 
 	sessionCancel()
@@ -236,6 +265,7 @@ func (cs *clientSession) buildClientProfile() (*eth.ClientProfile, error) {
 	profile := eth.ClientProfile{
 		Id:             clientId,
 		ConnectionType: cs.connectionType,
+		SyncMode:       cs.syncMode,
 		NetworkId:      networkId,
 		ChainId:        chainId,
 		NodeInfo:       nodeInfo,
@@ -350,6 +380,62 @@ func (cs *clientSession) subscribeToNewHeads(ctx context.Context) error {
 	return nil
 }
 
+func (cs *clientSession) subscribeToLogs(ctx context.Context) error {
+	requestCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// an empty filter matches all logs, filtering is applied by the proxy
+	subId, err := cs.client.SubscribeToLogs(requestCtx, web3.LogFilter{})
+	if err != nil {
+		return errors.Annotate(err, "failed to subscribe to logs")
+	}
+
+	cs.subscriptionIds = append(cs.subscriptionIds, subId)
+
+	logs := cs.client.HandleSubscription(subId)
+
+	cs.group.Go(func() error {
+		running := true
+		for running {
+			select {
+			case <-ctx.Done():
+				running = false
+			case notification, ok := <-logs:
+				running = ok
+				if notification != nil {
+					cs.onLog(notification)
+				}
+			}
+		}
+
+		cs.log.Debug("logs subscription closed")
+		return nil
+	})
+
+	return nil
+}
+
+func (cs *clientSession) onLog(notification *web3.SubscriptionNotification) {
+	var l web3.Log
+	if err := notification.UnmarshalResult(&l); err != nil {
+		cs.log.WithError(err).Error("failed to unmarshal log result")
+		return
+	}
+
+	if l.Removed {
+		// the proxy derives removals from the canonical chain, so we only publish additions
+		return
+	}
+
+	cp := cs.clientProfile
+	publisher := cs.logsPublisher.WithSubject(natseth.LogsSubject(cp.NetworkId, cp.ChainId, l.BlockHash))
+
+	_, err := publisher.PublishRaw(notification.Result, nats.MsgId(natseth.LogMsgId(l.BlockHash, l.LogIndex)))
+	if err != nil {
+		cs.log.WithError(err).Error("failed to publish log")
+	}
+}
+
 func (cs *clientSession) onNewHead(notification *web3.SubscriptionNotification) {
 	var newHead web3.NewHead
 	err := notification.UnmarshalResult(&newHead)
@@ -371,14 +457,15 @@ func (cs *clientSession) onNewHead(notification *web3.SubscriptionNotification)
 	// update client status
 	totalDifficulty := newHead.TotalDifficulty
 
-	if totalDifficulty == "" {
+	if totalDifficulty == "" && isProofOfWork(newHead.Difficulty) {
 		// we fetch the block again as total difficulty is not always available in the newHeads object depending on client impl.
-		// total difficulty is useful for working out re-orgs
+		// total difficulty is only useful for working out re-orgs on proof of work chains, after the merge it is frozen
+		// and fork choice is based on other criteria
 
 		requestCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		block, err := cs.client.LatestBlock(requestCtx)
+		block, err := cs.client.BlockByHash(requestCtx, newHead.Hash)
 		if err != nil {
 			cs.log.WithError(err).Error("failed to fetch block")
 			return
@@ -397,7 +484,15 @@ func (cs *clientSession) onNewHead(notification *web3.SubscriptionNotification)
 		},
 	}
 
-	mergedStatus, err := cs.clientStatus.Merge(&statusUpdate)
+	cs.updateStatus(&statusUpdate)
+}
+
+// updateStatus merges the update into the current client status and puts the result into the kv store.
+func (cs *clientSession) updateStatus(update *eth.ClientStatus) {
+	cs.statusMutex.Lock()
+	defer cs.statusMutex.Unlock()
+
+	mergedStatus, err := cs.clientStatus.Merge(update)
 	if err != nil {
 		log.WithError(err).Error("failed to merge client status")
 		return
@@ -405,7 +500,80 @@ func (cs *clientSession) onNewHead(notification *web3.SubscriptionNotification)
 
 	if _, err = cs.stateManager.Status.Put(mergedStatus.Id, *mergedStatus); err != nil {
 		log.WithError(err).Error("failed to put client status")
+		return
 	}
+
+	cs.clientStatus = mergedStatus
+}
+
+// pollCheckpoints periodically retrieves the safe and finalized blocks from the client and updates the client
+// status whenever they change. Clients which do not support the safe and finalized tags are simply skipped.
+func (cs *clientSession) pollCheckpoints(ctx context.Context) {
+	ticker := time.NewTicker(checkpointPollInterval)
+	defer ticker.Stop()
+
+	for {
+		cs.updateCheckpoints()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cs *clientSession) updateCheckpoints() {
+	safe, err := cs.fetchCheckpoint("safe")
+	if err != nil {
+		cs.log.WithError(err).Debug("failed to retrieve safe block")
+	}
+
+	finalized, err := cs.fetchCheckpoint("finalized")
+	if err != nil {
+		cs.log.WithError(err).Debug("failed to retrieve finalized block")
+	}
+
+	cs.statusMutex.Lock()
+	current := cs.clientStatus
+	cs.statusMutex.Unlock()
+
+	if sameBlockRef(current.Safe, safe) && sameBlockRef(current.Finalized, finalized) {
+		return
+	}
+
+	cs.updateStatus(&eth.ClientStatus{
+		Safe:      safe,
+		Finalized: finalized,
+	})
+}
+
+func (cs *clientSession) fetchCheckpoint(tag string) (*web3.BlockRef, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	block, err := cs.client.BlockByNumber(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Hash == "" {
+		// the client returned null e.g. before the merge
+		return nil, nil
+	}
+
+	return &web3.BlockRef{
+		BlockNumber: block.Number,
+		BlockHash:   block.Hash,
+	}, nil
+}
+
+func sameBlockRef(a *web3.BlockRef, b *web3.BlockRef) bool {
+	if b == nil {
+		// nothing new to report
+		return true
+	}
+	return a != nil && a.BlockHash == b.BlockHash
 }
 
 func (cs *clientSession) buildNewHeadsPublisher() error {
@@ -413,26 +581,14 @@ func (cs *clientSession) buildNewHeadsPublisher() error {
 	cv := cp.ClientVersion
 	version := eth.SanitizeVersion(cv.Version)
 
-	networkId := strconv.FormatUint(cp.NetworkId, 10)
-	chainId := strconv.FormatUint(cp.ChainId, 10)
-
-	subject := natsutil.SubjectName("eth", "newHeads", networkId, chainId, cv.Name, version, cp.Id)
+	subject := natseth.NewHeadsSubject(cp.NetworkId, cp.ChainId, cv.Name, version, cp.Id)
 
 	publisher, err := natsutil.NewPublisher[web3.NewHead](
 		natsJs, subject,
 		func(js nats.JetStreamContext) error {
-			streamConfig := &nats.StreamConfig{
-				Name:              fmt.Sprintf("eth_%s_%s_newHeads", networkId, chainId),
-				Description:       fmt.Sprintf("ETH newHeads for networkId %s and chainId %s", networkId, chainId),
-				Subjects:          []string{natsutil.SubjectName("eth", "newHeads", networkId, chainId, "*", "*", "*")},
-				MaxMsgsPerSubject: 128,
-			}
-
-			_, err := js.AddStream(streamConfig)
-			if err != nil {
+			if err := natseth.EnsureStream(js, natseth.NewHeadsStreamConfig(cp.NetworkId, cp.ChainId)); err != nil {
 				return errors.Annotate(err, "failed to create new heads stream")
 			}
-
 			return nil
 		},
 	)
@@ -440,3 +596,26 @@ func (cs *clientSession) buildNewHeadsPublisher() error {
 	cs.newHeadsPublisher = publisher
 	return err
 }
+
+func (cs *clientSession) buildLogsPublisher() error {
+	cp := cs.clientProfile
+
+	publisher, err := natsutil.NewPublisher[web3.Log](
+		natsJs, natseth.LogsSubject(cp.NetworkId, cp.ChainId, "*"),
+		func(js nats.JetStreamContext) error {
+			if err := natseth.EnsureStream(js, natseth.LogsStreamConfig(cp.NetworkId, cp.ChainId)); err != nil {
+				return errors.Annotate(err, "failed to create logs stream")
+			}
+			return nil
+		},
+	)
+
+	cs.logsPublisher = publisher
+	return err
+}
+
+// isProofOfWork returns true if the difficulty is non-zero.
+func isProofOfWork(difficulty string) bool {
+	value, err := hexutil.DecodeBig(difficulty)
+	return err == nil && value.Sign() > 0
+}
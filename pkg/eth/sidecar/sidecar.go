@@ -2,8 +2,13 @@ package sidecar
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/41north/tethys/pkg/eth"
+	"github.com/41north/tethys/pkg/health"
+	"github.com/41north/tethys/pkg/metrics"
+	"github.com/41north/tethys/pkg/tracing"
 	"github.com/juju/errors"
 
 	log "github.com/sirupsen/logrus"
@@ -13,9 +18,12 @@ import (
 const (
 	DefaultClientURL            = "ws://127.0.0.1:8546"
 	DefaultClientConnectionType = eth.ConnectionTypeDirect
+	DefaultClientSyncMode       = eth.SyncModeFull
 	DefaultNatsURL              = "ns://127.0.0.1:4222"
 	DefaultBucketClientProfile  = "eth_client_profiles"
 	DefaultBucketClientStatus   = "eth_client_statuses"
+	DefaultMetricsAddress       = ":8081"
+	DefaultTracingEndpoint      = ""
 )
 
 type Option func(opts *Options) error
@@ -25,11 +33,18 @@ type Options struct {
 	ClientUrl            string
 	ClientId             *string
 	ClientConnectionType eth.ConnectionType
+	ClientSyncMode       eth.SyncMode
 
 	NatsUrl string
 
 	BucketClientProfile string
 	BucketClientStatus  string
+
+	// MetricsAddress is the address on which metrics and the health endpoints are served, empty to disable.
+	MetricsAddress string
+
+	// TracingEndpoint is the OTLP http endpoint to which traces are exported, empty to disable tracing.
+	TracingEndpoint string
 }
 
 func ClientUrl(url string) Option {
@@ -60,6 +75,20 @@ func BucketClientStatus(bucket string) Option {
 	}
 }
 
+func MetricsAddress(address string) Option {
+	return func(opts *Options) error {
+		opts.MetricsAddress = address
+		return nil
+	}
+}
+
+func TracingEndpoint(endpoint string) Option {
+	return func(opts *Options) error {
+		opts.TracingEndpoint = endpoint
+		return nil
+	}
+}
+
 func ClientId(id string) Option {
 	return func(opts *Options) error {
 		opts.ClientId = &id
@@ -77,14 +106,28 @@ func ClientConnectionType(connectionType eth.ConnectionType) Option {
 	}
 }
 
+func ClientSyncMode(syncMode string) Option {
+	return func(opts *Options) error {
+		mode, ok := eth.ToSyncMode(syncMode)
+		if !ok {
+			return errors.Errorf("invalid sync mode: %s", syncMode)
+		}
+		opts.ClientSyncMode = mode
+		return nil
+	}
+}
+
 // GetDefaultOptions returns default configuration options for the sidecar.
 func GetDefaultOptions() Options {
 	return Options{
 		ClientUrl:            DefaultClientURL,
 		ClientConnectionType: DefaultClientConnectionType,
+		ClientSyncMode:       DefaultClientSyncMode,
 		NatsUrl:              DefaultNatsURL,
 		BucketClientProfile:  DefaultBucketClientProfile,
 		BucketClientStatus:   DefaultBucketClientStatus,
+		MetricsAddress:       DefaultMetricsAddress,
+		TracingEndpoint:      DefaultTracingEndpoint,
 	}
 }
 
@@ -103,10 +146,32 @@ func Run(ctx context.Context, options ...Option) error {
 		}
 	}
 
+	shutdownTracing, err := tracing.Init(ctx, "tethys-sidecar", opts.TracingEndpoint)
+	if err != nil {
+		return errors.Annotate(err, "failed to initialise tracing")
+	}
+	defer func() {
+		// the context is done by now, allow time to flush pending spans
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(timeoutCtx)
+	}()
+
 	if err := connectNats(opts); err != nil {
 		return err
 	}
 
+	if opts.MetricsAddress != "" {
+		mux := http.NewServeMux()
+		health.Register(mux, ready)
+
+		go func() {
+			if err := metrics.ListenAndServe(ctx, opts.MetricsAddress, mux); err != nil {
+				log.WithError(err).Error("metrics server failed")
+			}
+		}()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
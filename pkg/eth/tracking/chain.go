@@ -21,18 +21,26 @@ type CanonicalChain struct {
 	ChainId   uint64
 
 	maxDistanceFromHead int
+	forkChoice          ForkChoice
 
 	log *log.Entry
 
+	// mutex guards the blocks being tracked, including the client ids of each block, which are written by
+	// process and read on the request path
+	mutex        sync.RWMutex
 	head         atomic.Value
 	blocksByHash btree.Map[string, *Block]
 
+	clientsMutex sync.RWMutex
+	clients      map[string]ClientState
+
 	wg     *sync.WaitGroup
 	cancel context.CancelFunc
 
 	updates <-chan natsutil.KeyValueEntry[eth.ClientStatus]
 
-	listeners []chan<- *CanonicalChain
+	listeners      []chan<- *CanonicalChain
+	reorgListeners []chan<- ReorgEvent
 }
 
 func (cc *CanonicalChain) Head() *Block {
@@ -45,14 +53,175 @@ func (cc *CanonicalChain) Head() *Block {
 }
 
 func (cc *CanonicalChain) BlockByHash(hash string) (*Block, bool) {
+	cc.mutex.RLock()
+	defer cc.mutex.RUnlock()
 	return cc.blocksByHash.Get(hash)
 }
 
+// ClientIds returns the ids of the clients whose head is the block.
+func (cc *CanonicalChain) ClientIds(block *Block) []string {
+	cc.mutex.RLock()
+	defer cc.mutex.RUnlock()
+	return block.ClientIds.Keys()
+}
+
+// Safe returns the highest safe block reported by any client, or nil if no client has reported one.
+func (cc *CanonicalChain) Safe() *BlockRef {
+	return cc.highestCheckpoint(func(state ClientState) *BlockRef { return state.Safe })
+}
+
+// Finalized returns the highest finalized block reported by any client, or nil if no client has reported one.
+func (cc *CanonicalChain) Finalized() *BlockRef {
+	return cc.highestCheckpoint(func(state ClientState) *BlockRef { return state.Finalized })
+}
+
+func (cc *CanonicalChain) highestCheckpoint(fn func(state ClientState) *BlockRef) *BlockRef {
+	cc.clientsMutex.RLock()
+	defer cc.clientsMutex.RUnlock()
+	var result *BlockRef
+	for _, state := range cc.clients {
+		ref := fn(state)
+		if ref != nil && (result == nil || result.Number.Cmp(ref.Number) < 0) {
+			result = ref
+		}
+	}
+	return result
+}
+
+// Checkpoints returns the hashes of the latest checkpoints reported by the clients, most recent first.
+func (cc *CanonicalChain) Checkpoints() []string {
+	var result []string
+	for _, ref := range []*BlockRef{cc.Safe(), cc.Finalized()} {
+		if ref != nil {
+			result = append(result, ref.BlockHash)
+		}
+	}
+	return result
+}
+
+// CanonicalBlockByNumber returns the canonical block at the given height, or false if it is not being tracked.
+func (cc *CanonicalChain) CanonicalBlockByNumber(number *big.Int) (*Block, bool) {
+	cc.mutex.RLock()
+	defer cc.mutex.RUnlock()
+	head := cc.Head()
+	if head == nil {
+		return nil, false
+	}
+	return cc.ancestorAt(head, number)
+}
+
+// Client returns the latest state reported by the client.
+func (cc *CanonicalChain) Client(id string) (ClientState, bool) {
+	cc.clientsMutex.RLock()
+	defer cc.clientsMutex.RUnlock()
+	state, ok := cc.clients[id]
+	return state, ok
+}
+
+// Clients returns the latest state reported by all clients.
+func (cc *CanonicalChain) Clients() []ClientState {
+	cc.clientsMutex.RLock()
+	defer cc.clientsMutex.RUnlock()
+	result := make([]ClientState, 0, len(cc.clients))
+	for _, state := range cc.clients {
+		result = append(result, state)
+	}
+	return result
+}
+
+// ancestorAt walks back from the block to the given height. It returns false if the ancestor is not being tracked.
+// The caller must hold the mutex, as must the callers of the other unexported helpers which read the blocks.
+func (cc *CanonicalChain) ancestorAt(block *Block, number *big.Int) (*Block, bool) {
+	for block != nil && block.Number.Cmp(number) > 0 {
+		block, _ = cc.blocksByHash.Get(block.ParentHash)
+	}
+	return block, block != nil && block.Number.Cmp(number) == 0
+}
+
+// descendsFrom determines if the block is the given ancestor or one of its descendants. The second return
+// value is false if this cannot be determined from the blocks being tracked.
+func (cc *CanonicalChain) descendsFrom(block *Block, ancestorHash string) (bool, bool) {
+	ancestor, ok := cc.blocksByHash.Get(ancestorHash)
+	if !ok {
+		return false, false
+	}
+	if block.Number.Cmp(ancestor.Number) < 0 {
+		return false, true
+	}
+	candidate, ok := cc.ancestorAt(block, ancestor.Number)
+	if !ok {
+		return false, false
+	}
+	return candidate.BlockHash == ancestor.BlockHash, true
+}
+
+// divergence finds the common ancestor of two blocks and returns the first block on each branch after it.
+// A nil branch indicates that block is itself the common ancestor. The last return value is false if the
+// common ancestor is not being tracked.
+func (cc *CanonicalChain) divergence(a *Block, b *Block) (*Block, *Block, bool) {
+	var aBranch, bBranch *Block
+	for a != nil && b != nil {
+		if a.BlockHash == b.BlockHash {
+			return aBranch, bBranch, true
+		}
+		cmp := a.Number.Cmp(b.Number)
+		if cmp >= 0 {
+			aBranch = a
+			a, _ = cc.blocksByHash.Get(a.ParentHash)
+		}
+		if cmp <= 0 {
+			bBranch = b
+			b, _ = cc.blocksByHash.Get(b.ParentHash)
+		}
+	}
+	return nil, nil, false
+}
+
+// support returns the number of clients whose head is the block or one of its descendants.
+func (cc *CanonicalChain) support(block *Block) int {
+	count := 0
+	for _, state := range cc.clients {
+		if state.Head == nil {
+			continue
+		}
+		head, ok := cc.blocksByHash.Get(state.Head.BlockHash)
+		if !ok {
+			continue
+		}
+		if descends, _ := cc.descendsFrom(head, block.BlockHash); descends {
+			count += 1
+		}
+	}
+	return count
+}
+
 func (cc *CanonicalChain) AddListener(ch chan<- *CanonicalChain) {
 	cc.listeners = append(cc.listeners, ch)
 }
 
+// AddReorgListener registers a channel which will receive an event whenever a re-org is detected. Events are
+// delivered in the order they were detected and processing waits for each send, so the channel should be
+// buffered and drained promptly.
+func (cc *CanonicalChain) AddReorgListener(ch chan<- ReorgEvent) {
+	cc.reorgListeners = append(cc.reorgListeners, ch)
+}
+
+// Blocks returns the canonical blocks being tracked, from the head back to the oldest ancestor.
+func (cc *CanonicalChain) Blocks() []*Block {
+	cc.mutex.RLock()
+	defer cc.mutex.RUnlock()
+	var result []*Block
+	block := cc.Head()
+	for block != nil {
+		result = append(result, block)
+		block, _ = cc.blocksByHash.Get(block.ParentHash)
+	}
+	return result
+}
+
 func (cc *CanonicalChain) String() string {
+	cc.mutex.RLock()
+	defer cc.mutex.RUnlock()
 	var sb strings.Builder
 	block := cc.Head()
 	for block != nil {
@@ -83,13 +252,23 @@ func NewCanonicalChain(
 	chainId uint64,
 	updates <-chan natsutil.KeyValueEntry[eth.ClientStatus],
 	maxDistanceFromHead int,
+	forkChoice ForkChoice,
 ) (*CanonicalChain, error) {
+	if forkChoice == nil {
+		forkChoice = autoForkChoice{}
+	}
+
 	bc := CanonicalChain{
 		NetworkId:           networkId,
 		ChainId:             chainId,
 		maxDistanceFromHead: maxDistanceFromHead,
+		forkChoice:          forkChoice,
+		clients:             make(map[string]ClientState),
 		updates:             updates,
-		log:                 log.WithField("component", "CanonicalChain"),
+		log: log.WithFields(log.Fields{
+			"component":  "CanonicalChain",
+			"forkChoice": forkChoice.Name(),
+		}),
 	}
 
 	return &bc, nil
@@ -120,123 +299,238 @@ func (cc *CanonicalChain) process(ctx context.Context) {
 
 		case update, ok := <-cc.updates:
 			if update != nil {
+				reorg := cc.apply(update)
+
+				// notify reorg listeners in order, outside of the lock so that readers are not blocked
+				if reorg != nil {
+					for _, listener := range cc.reorgListeners {
+						select {
+						case listener <- *reorg:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
 
-				switch update.Operation() {
+				// notify listeners
+				for _, listener := range cc.listeners {
+					go func(listener chan<- *CanonicalChain) {
+						listener <- cc
+					}(listener)
+				}
 
-				case nats.KeyValuePut:
-					status, err := update.Value()
-					if err != nil {
-						cc.log.WithError(err).Error("failed to retrieve client status from update")
-						continue
-					}
+				cc.log.WithField("chain", cc).Debug("chain updated")
+			}
+			if !ok {
+				// update channel has been closed
+				return
+			}
+		}
+	}
+}
 
-					head := status.Head
+// apply updates the blocks being tracked with a client status update. The blocks are shared with readers on
+// the request path so the write lock is held throughout. A re-org caused by the update is returned.
+func (cc *CanonicalChain) apply(update natsutil.KeyValueEntry[eth.ClientStatus]) (reorg *ReorgEvent) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
 
-					var block *Block
+	switch update.Operation() {
 
-					block, ok := cc.blocksByHash.Get(status.Head.BlockHash)
-					if !ok {
+	case nats.KeyValuePut:
+		status, err := update.Value()
+		if err != nil {
+			cc.log.WithError(err).Error("failed to retrieve client status from update")
+			return
+		}
 
-						number, err := head.BlockNumberBI()
-						if err != nil {
-							cc.log.WithError(err).Error("failed to process update")
-							continue
-						}
+		head := status.Head
 
-						difficulty, err := head.DifficultyBI()
-						if err != nil {
-							cc.log.WithError(err).Error("failed to process update")
-							continue
-						}
+		var block *Block
 
-						totalDifficulty, err := head.TotalDifficultyBI()
-						if err != nil {
-							cc.log.WithError(err).Error("failed to process update")
-							continue
-						}
+		block, ok := cc.blocksByHash.Get(status.Head.BlockHash)
+		if !ok {
 
-						// create a new block entry
-						block = &Block{
-							Number:          number,
-							BlockHash:       head.BlockHash,
-							ParentHash:      head.ParentHash,
-							Difficulty:      difficulty,
-							TotalDifficulty: totalDifficulty,
-							ClientIds:       btree.Set[string]{},
-						}
+			number, err := head.BlockNumberBI()
+			if err != nil {
+				cc.log.WithError(err).Error("failed to process update")
+				return
+			}
 
-						// add it to the map
-						cc.blocksByHash.Set(block.BlockHash, block)
-					}
+			difficulty, err := head.DifficultyBI()
+			if err != nil {
+				cc.log.WithError(err).Error("failed to process update")
+				return
+			}
 
-					// register that this client has the specified block
-					block.ClientIds.Insert(update.Key())
+			// total difficulty is not always available and is frozen after the merge
+			var totalDifficulty *big.Int
+			if head.TotalDifficulty != "" {
+				totalDifficulty, err = head.TotalDifficultyBI()
+				if err != nil {
+					cc.log.WithError(err).Error("failed to process update")
+					return
+				}
+			}
 
-					cc.log.WithField("block", block).Debug("updated block")
+			// create a new block entry
+			block = &Block{
+				Number:          number,
+				BlockHash:       head.BlockHash,
+				ParentHash:      head.ParentHash,
+				Difficulty:      difficulty,
+				TotalDifficulty: totalDifficulty,
+				ClientIds:       btree.Set[string]{},
+			}
 
-					// check if we have a new head by comparing the total difficulty of both blocks
-					// the one with the greatest total difficulty is the head
-					currentHead := cc.Head()
-					if currentHead == nil || currentHead.TotalDifficulty.Cmp(block.TotalDifficulty) == -1 {
-						cc.head.Store(block)
-					}
+			// add it to the map
+			cc.blocksByHash.Set(block.BlockHash, block)
+		}
 
-				case nats.KeyValueDelete, nats.KeyValuePurge:
+		// register that this client has the specified block
+		block.ClientIds.Insert(update.Key())
 
-					clientId := update.Key()
+		if err = cc.updateClient(update.Key(), block, &status); err != nil {
+			cc.log.WithError(err).Error("failed to update client state")
+		}
 
-					cc.blocksByHash.Scan(func(key string, value *Block) bool {
-						// remove the client from the block
-						value.ClientIds.Delete(clientId)
+		cc.log.WithField("block", block).Debug("updated block")
 
-						if value.ClientIds.Len() == 0 {
-							// remove the block entry as there are no clients
-							cc.blocksByHash.Delete(key)
-						}
+		// check if we have a new head according to the fork choice
+		currentHead := cc.Head()
+		if currentHead == nil || cc.forkChoice.IsBetter(cc, currentHead, block) {
+			cc.head.Store(block)
 
-						// continue scanning
-						return true
-					})
+			if currentHead != nil {
+				reorg = cc.checkForReorg(currentHead, block)
+			}
+		}
 
-				default:
-					cc.log.Errorf("unexpected kv operation: %s", update.Operation())
+	case nats.KeyValueDelete, nats.KeyValuePurge:
 
-				}
+		clientId := update.Key()
 
-				if cc.blocksByHash.Len() > cc.maxDistanceFromHead {
+		cc.clientsMutex.Lock()
+		delete(cc.clients, clientId)
+		cc.clientsMutex.Unlock()
 
-					headNumber := cc.Head().Number
-					maxDistanceFromHead := big.NewInt(int64(cc.maxDistanceFromHead))
+		cc.blocksByHash.Scan(func(key string, value *Block) bool {
+			// remove the client from the block
+			value.ClientIds.Delete(clientId)
 
-					cc.blocksByHash.Scan(func(key string, value *Block) bool {
-						distanceFromHead := big.Int{}
-						distanceFromHead.Sub(headNumber, value.Number)
+			if value.ClientIds.Len() == 0 {
+				// remove the block entry as there are no clients
+				cc.blocksByHash.Delete(key)
+			}
 
-						if distanceFromHead.Cmp(maxDistanceFromHead) > 0 {
-							// too far from head, remove the entry
-							cc.blocksByHash.Delete(key)
-						}
+			// continue scanning
+			return true
+		})
 
-						// continue scanning
-						return true
-					})
-				}
+	default:
+		cc.log.Errorf("unexpected kv operation: %s", update.Operation())
 
-				// notify listeners
-				for _, listener := range cc.listeners {
-					go func(listener chan<- *CanonicalChain) {
-						listener <- cc
-					}(listener)
-				}
+	}
 
-				cc.log.WithField("chain", cc).Debug("chain updated")
-			}
-			if !ok {
-				// update channel has been closed
-				return
+	if cc.blocksByHash.Len() > cc.maxDistanceFromHead {
+
+		headNumber := cc.Head().Number
+		maxDistanceFromHead := big.NewInt(int64(cc.maxDistanceFromHead))
+
+		cc.blocksByHash.Scan(func(key string, value *Block) bool {
+			distanceFromHead := big.Int{}
+			distanceFromHead.Sub(headNumber, value.Number)
+
+			if distanceFromHead.Cmp(maxDistanceFromHead) > 0 {
+				// too far from head, remove the entry
+				cc.blocksByHash.Delete(key)
 			}
+
+			// continue scanning
+			return true
+		})
+	}
+
+	return reorg
+}
+
+func (cc *CanonicalChain) updateClient(id string, head *Block, status *eth.ClientStatus) error {
+	safe, err := newBlockRef(status.Safe)
+	if err != nil {
+		return err
+	}
+
+	finalized, err := newBlockRef(status.Finalized)
+	if err != nil {
+		return err
+	}
+
+	cc.clientsMutex.Lock()
+	defer cc.clientsMutex.Unlock()
+
+	cc.clients[id] = ClientState{
+		Id:        id,
+		Head:      &BlockRef{Number: head.Number, BlockHash: head.BlockHash},
+		Safe:      safe,
+		Finalized: finalized,
+	}
+
+	return nil
+}
+
+// checkForReorg determines if the old head is an ancestor of the new head and if not returns the re-org.
+func (cc *CanonicalChain) checkForReorg(oldHead *Block, newHead *Block) *ReorgEvent {
+	if newHead.ParentHash == oldHead.BlockHash {
+		// simple extension of the chain
+		return nil
+	}
+
+	var dropped, added []string
+	commonAncestor := ""
+
+	oldBlock, newBlock := oldHead, newHead
+
+	for oldBlock != nil && newBlock != nil {
+		if oldBlock.BlockHash == newBlock.BlockHash {
+			commonAncestor = oldBlock.BlockHash
+			break
+		}
+
+		// step back along whichever chain is higher, or both if they are at the same height
+		cmp := oldBlock.Number.Cmp(newBlock.Number)
+		if cmp >= 0 {
+			dropped = append(dropped, oldBlock.BlockHash)
+			oldBlock, _ = cc.blocksByHash.Get(oldBlock.ParentHash)
 		}
+		if cmp <= 0 {
+			added = append(added, newBlock.BlockHash)
+			newBlock, _ = cc.blocksByHash.Get(newBlock.ParentHash)
+		}
+	}
+
+	if len(dropped) == 0 {
+		// the new head descends from the old head, blocks were skipped but nothing was dropped
+		return nil
 	}
+
+	// order from oldest to newest
+	reverse(dropped)
+	reverse(added)
+
+	event := ReorgEvent{
+		NetworkId:      cc.NetworkId,
+		ChainId:        cc.ChainId,
+		Depth:          len(dropped),
+		CommonAncestor: commonAncestor,
+		OldHead:        oldHead.BlockHash,
+		NewHead:        newHead.BlockHash,
+		Dropped:        dropped,
+		Added:          added,
+	}
+
+	cc.log.WithField("reorg", event).Info("re-org detected")
+
+	return &event
 }
 
 func (cc *CanonicalChain) Close() {
@@ -0,0 +1,163 @@
+package tracking
+
+import (
+	"sync/atomic"
+
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ForkChoiceAuto            = "auto"
+	ForkChoiceTotalDifficulty = "total-difficulty"
+	ForkChoiceHighestNumber   = "highest-number"
+	ForkChoiceMostClients     = "most-clients"
+	ForkChoiceCheckpoint      = "checkpoint"
+)
+
+var ForkChoices = []string{
+	ForkChoiceAuto, ForkChoiceTotalDifficulty, ForkChoiceHighestNumber, ForkChoiceMostClients, ForkChoiceCheckpoint,
+}
+
+// ForkChoice decides which of two blocks should be considered the canonical head.
+type ForkChoice interface {
+	Name() string
+	// IsBetter returns true if the candidate should replace the current head.
+	IsBetter(chain *CanonicalChain, current *Block, candidate *Block) bool
+}
+
+// NewForkChoice returns the fork choice strategy with the given name.
+func NewForkChoice(name string) (ForkChoice, error) {
+	switch name {
+	case ForkChoiceAuto:
+		return autoForkChoice{}, nil
+	case ForkChoiceTotalDifficulty:
+		return totalDifficultyForkChoice{}, nil
+	case ForkChoiceHighestNumber:
+		return highestNumberForkChoice{}, nil
+	case ForkChoiceMostClients:
+		return mostClientsForkChoice{}, nil
+	case ForkChoiceCheckpoint:
+		return checkpointForkChoice{fallback: highestNumberForkChoice{}, noCheckpoints: &atomic.Bool{}}, nil
+	default:
+		return nil, errors.Errorf("unknown fork choice: %s", name)
+	}
+}
+
+// totalDifficultyForkChoice selects the block with the greatest total difficulty, which is only meaningful
+// for proof of work chains. Blocks without a total difficulty fall back to the highest number.
+type totalDifficultyForkChoice struct{}
+
+func (fc totalDifficultyForkChoice) Name() string {
+	return ForkChoiceTotalDifficulty
+}
+
+func (fc totalDifficultyForkChoice) IsBetter(chain *CanonicalChain, current *Block, candidate *Block) bool {
+	if current.TotalDifficulty == nil || candidate.TotalDifficulty == nil {
+		return highestNumberForkChoice{}.IsBetter(chain, current, candidate)
+	}
+	return current.TotalDifficulty.Cmp(candidate.TotalDifficulty) < 0
+}
+
+// highestNumberForkChoice selects the block with the highest number. When two blocks have the same number
+// the current head is retained.
+type highestNumberForkChoice struct{}
+
+func (fc highestNumberForkChoice) Name() string {
+	return ForkChoiceHighestNumber
+}
+
+func (fc highestNumberForkChoice) IsBetter(_ *CanonicalChain, current *Block, candidate *Block) bool {
+	return current.Number.Cmp(candidate.Number) < 0
+}
+
+// autoForkChoice uses total difficulty whilst both blocks were produced by proof of work, and the highest
+// number otherwise e.g. after the merge when total difficulty is frozen.
+type autoForkChoice struct{}
+
+func (fc autoForkChoice) Name() string {
+	return ForkChoiceAuto
+}
+
+func (fc autoForkChoice) IsBetter(chain *CanonicalChain, current *Block, candidate *Block) bool {
+	if current.isProofOfWork() && candidate.isProofOfWork() {
+		return totalDifficultyForkChoice{}.IsBetter(chain, current, candidate)
+	}
+	return highestNumberForkChoice{}.IsBetter(chain, current, candidate)
+}
+
+// mostClientsForkChoice selects the branch which the most clients are following. Starting from the point
+// where the two blocks diverge, the branch whose descendants are the head of the most clients wins, with
+// ties resolved by the highest number.
+type mostClientsForkChoice struct{}
+
+func (fc mostClientsForkChoice) Name() string {
+	return ForkChoiceMostClients
+}
+
+func (fc mostClientsForkChoice) IsBetter(chain *CanonicalChain, current *Block, candidate *Block) bool {
+	currentBranch, candidateBranch, ok := chain.divergence(current, candidate)
+	if !ok {
+		return highestNumberForkChoice{}.IsBetter(chain, current, candidate)
+	}
+
+	switch {
+	case candidateBranch == nil:
+		// the candidate is an ancestor of the current head
+		return false
+	case currentBranch == nil:
+		// the candidate descends from the current head
+		return true
+	}
+
+	currentSupport := chain.support(currentBranch)
+	candidateSupport := chain.support(candidateBranch)
+
+	if currentSupport != candidateSupport {
+		return currentSupport < candidateSupport
+	}
+	return highestNumberForkChoice{}.IsBetter(chain, current, candidate)
+}
+
+// checkpointForkChoice never selects a block which does not descend from the latest checkpoint provided by
+// the consensus layer, otherwise deferring to the fallback. Checkpoints are the safe and finalized blocks
+// reported by the clients.
+type checkpointForkChoice struct {
+	fallback ForkChoice
+	// noCheckpoints is set whilst no client has reported a checkpoint, so the fallback is logged once
+	noCheckpoints *atomic.Bool
+}
+
+func (fc checkpointForkChoice) Name() string {
+	return ForkChoiceCheckpoint
+}
+
+func (fc checkpointForkChoice) IsBetter(chain *CanonicalChain, current *Block, candidate *Block) bool {
+	checkpoints := chain.Checkpoints()
+	if len(checkpoints) == 0 {
+		if fc.noCheckpoints.CompareAndSwap(false, true) {
+			log.WithFields(log.Fields{
+				"component": "checkpointForkChoice",
+				"fallback":  fc.fallback.Name(),
+			}).Warn("no client has reported a safe or finalized block, falling back")
+		}
+	} else {
+		fc.noCheckpoints.Store(false)
+	}
+
+	for _, checkpoint := range checkpoints {
+		currentOk, currentKnown := chain.descendsFrom(current, checkpoint)
+		candidateOk, candidateKnown := chain.descendsFrom(candidate, checkpoint)
+
+		if !(currentKnown && candidateKnown) {
+			// try an older checkpoint
+			continue
+		}
+
+		if currentOk != candidateOk {
+			return candidateOk
+		}
+		break
+	}
+	return fc.fallback.IsBetter(chain, current, candidate)
+}
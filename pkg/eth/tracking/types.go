@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/41north/tethys/pkg/eth/web3"
 	"github.com/41north/tethys/pkg/util"
 
 	"github.com/tidwall/btree"
@@ -18,6 +19,11 @@ type Block struct {
 	ClientIds       btree.Set[string]
 }
 
+// isProofOfWork returns true if the block has a non-zero difficulty and a known total difficulty.
+func (b Block) isProofOfWork() bool {
+	return b.Difficulty != nil && b.Difficulty.Sign() > 0 && b.TotalDifficulty != nil
+}
+
 func (b Block) String() string {
 	return fmt.Sprintf(
 		"Block{Number: %s, Hash: %s, ParentHash: %s, Difficulty: %s, TotalDifficulty: %s, Clients: %d}",
@@ -25,7 +31,67 @@ func (b Block) String() string {
 	)
 }
 
+// BlockRef identifies a block by number and hash.
+type BlockRef struct {
+	Number    *big.Int `json:"number"`
+	BlockHash string   `json:"hash"`
+}
+
+func newBlockRef(ref *web3.BlockRef) (*BlockRef, error) {
+	if ref == nil {
+		return nil, nil
+	}
+	number, err := ref.BlockNumberBI()
+	if err != nil {
+		return nil, err
+	}
+	return &BlockRef{Number: number, BlockHash: ref.BlockHash}, nil
+}
+
+// ClientState is the latest head and checkpoints reported by a client.
+type ClientState struct {
+	Id        string    `json:"id"`
+	Head      *BlockRef `json:"head,omitempty"`
+	Safe      *BlockRef `json:"safe,omitempty"`
+	Finalized *BlockRef `json:"finalized,omitempty"`
+}
+
+// HasBlock returns true if the client's head is at or past the given block number.
+func (cs ClientState) HasBlock(number *big.Int) bool {
+	return cs.Head != nil && cs.Head.Number.Cmp(number) >= 0
+}
+
 type BlocksForNumber struct {
 	Number *big.Int
 	Blocks []*Block
 }
+
+// ReorgEvent describes a change of canonical head where the previous head is not an ancestor of the new head.
+type ReorgEvent struct {
+	NetworkId uint64 `json:"networkId"`
+	ChainId   uint64 `json:"chainId"`
+
+	// Depth is the number of blocks which are no longer canonical.
+	Depth int `json:"depth"`
+
+	// CommonAncestor is the hash of the most recent block shared by both the old and new chain. It is empty
+	// if the common ancestor could not be determined from the blocks being tracked.
+	CommonAncestor string `json:"commonAncestor,omitempty"`
+
+	OldHead string `json:"oldHead"`
+	NewHead string `json:"newHead"`
+
+	// Dropped contains the hashes of the blocks which are no longer canonical, ordered from oldest to newest.
+	Dropped []string `json:"dropped"`
+
+	// Added contains the hashes of the blocks which have become canonical, ordered from oldest to newest.
+	Added []string `json:"added"`
+}
+
+func (e ReorgEvent) String() string {
+	return fmt.Sprintf(
+		"ReorgEvent{Depth: %d, CommonAncestor: %s, OldHead: %s, NewHead: %s, Dropped: %d, Added: %d}",
+		e.Depth, util.ElideString(e.CommonAncestor), util.ElideString(e.OldHead), util.ElideString(e.NewHead),
+		len(e.Dropped), len(e.Added),
+	)
+}
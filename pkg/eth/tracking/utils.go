@@ -9,3 +9,9 @@ func blocksByBlockNumber(a, b *Block) bool {
 	}
 	return a.Number.Cmp(b.Number) < 0
 }
+
+func reverse(hashes []string) {
+	for i, j := 0, len(hashes)-1; i < j; i, j = i+1, j-1 {
+		hashes[i], hashes[j] = hashes[j], hashes[i]
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/41north/tethys/pkg/eth/web3"
 )
@@ -53,6 +54,31 @@ func (ct *ConnectionType) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// SyncMode describes how much history a client retains.
+type SyncMode string
+
+const (
+	// SyncModeArchive clients retain all blocks and all historical state.
+	SyncModeArchive SyncMode = "archive"
+	// SyncModeFull clients retain all blocks but only recent state.
+	SyncModeFull SyncMode = "full"
+	// SyncModeSnap clients may be missing historical blocks and state.
+	SyncModeSnap SyncMode = "snap"
+	// SyncModeUnknown is used when the sync mode has not been specified.
+	SyncModeUnknown SyncMode = ""
+)
+
+var SyncModes = []SyncMode{SyncModeArchive, SyncModeFull, SyncModeSnap}
+
+func ToSyncMode(s string) (SyncMode, bool) {
+	for _, mode := range SyncModes {
+		if string(mode) == s {
+			return mode, true
+		}
+	}
+	return SyncModeUnknown, false
+}
+
 type NetworkAndChainId struct {
 	NetworkId uint64 `json:"networkId"`
 	ChainId   uint64 `json:"chainId"`
@@ -61,6 +87,7 @@ type NetworkAndChainId struct {
 type ClientProfile struct {
 	Id             string         `json:"id"`
 	ConnectionType ConnectionType `json:"connectionType"`
+	SyncMode       SyncMode       `json:"syncMode,omitempty"`
 
 	NetworkId uint64 `json:"networkId"`
 	ChainId   uint64 `json:"chainId"`
@@ -79,13 +106,55 @@ func (cp ClientProfile) String() string {
 type ClientStatus struct {
 	Id         string           `json:"id"`
 	Head       *web3.Head       `json:"head,omitempty"`
+	Safe       *web3.BlockRef   `json:"safe,omitempty"`
+	Finalized  *web3.BlockRef   `json:"finalized,omitempty"`
 	SyncStatus *web3.SyncStatus `json:"syncStatus,omitempty"`
 }
 
+// TransactionBroadcast records which clients accepted a raw transaction when it was broadcast.
+type TransactionBroadcast struct {
+	Hash       string    `json:"hash"`
+	AcceptedBy []string  `json:"acceptedBy"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// ApiKey grants access to the proxy. Keys are stored against the hex encoded sha256 hash of the key so that
+// reading the bucket does not reveal them.
+type ApiKey struct {
+	// Name identifies the holder of the key in logs and metrics.
+	Name string `json:"name"`
+	// Disabled keys are rejected without having to delete them.
+	Disabled bool `json:"disabled,omitempty"`
+	// Methods the key may invoke, empty for all methods.
+	Methods []string `json:"methods,omitempty"`
+	// RequestsPerSecond is the sustained rate of requests allowed per proxy instance, 0 for no limit.
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+	// Burst is the number of requests which can be made at once above the sustained rate.
+	Burst int `json:"burst,omitempty"`
+}
+
+type FilterType string
+
+const (
+	FilterTypeBlock = FilterType("block")
+	FilterTypeLogs  = FilterType("logs")
+)
+
+// Filter is a server side filter installed with eth_newFilter or eth_newBlockFilter. The cursor is the
+// last block for which changes have been returned.
+type Filter struct {
+	Id       string          `json:"id"`
+	Type     FilterType      `json:"type"`
+	Criteria *web3.LogFilter `json:"criteria,omitempty"`
+	Cursor   web3.BlockRef   `json:"cursor"`
+}
+
 func (cs *ClientStatus) Merge(src *ClientStatus) (*ClientStatus, error) {
 	merged := &ClientStatus{
 		Id:         cs.Id,
 		Head:       cs.Head,
+		Safe:       cs.Safe,
+		Finalized:  cs.Finalized,
 		SyncStatus: cs.SyncStatus,
 	}
 
@@ -93,6 +162,14 @@ func (cs *ClientStatus) Merge(src *ClientStatus) (*ClientStatus, error) {
 		merged.Head = src.Head
 	}
 
+	if src.Safe != nil {
+		merged.Safe = src.Safe
+	}
+
+	if src.Finalized != nil {
+		merged.Finalized = src.Finalized
+	}
+
 	if src.SyncStatus != nil {
 		merged.SyncStatus = src.SyncStatus
 	}
@@ -0,0 +1,96 @@
+package web3
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/juju/errors"
+)
+
+type Log struct {
+	Address          string   `json:"address"`
+	Topics           []string `json:"topics"`
+	Data             string   `json:"data"`
+	BlockNumber      string   `json:"blockNumber"`
+	TransactionHash  string   `json:"transactionHash"`
+	TransactionIndex string   `json:"transactionIndex"`
+	BlockHash        string   `json:"blockHash"`
+	LogIndex         string   `json:"logIndex"`
+	Removed          bool     `json:"removed"`
+}
+
+func (l *Log) BlockNumberU64() (uint64, error) {
+	return hexutil.DecodeUint64(l.BlockNumber)
+}
+
+func (l *Log) LogIndexU64() (uint64, error) {
+	return hexutil.DecodeUint64(l.LogIndex)
+}
+
+// StringOrSlice unmarshals from either a single json string, an array of strings or null.
+type StringOrSlice []string
+
+func (s *StringOrSlice) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = nil
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		*s = StringOrSlice{str}
+		return nil
+	default:
+		var slice []string
+		if err := json.Unmarshal(data, &slice); err != nil {
+			return errors.Annotate(err, "expected a string or an array of strings")
+		}
+		*s = slice
+		return nil
+	}
+}
+
+// containsFold returns true if the slice contains the value, ignoring case.
+func (s StringOrSlice) containsFold(value string) bool {
+	for _, candidate := range s {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// LogFilter is the filter object accepted by eth_getLogs, eth_newFilter and logs subscriptions.
+type LogFilter struct {
+	FromBlock string          `json:"fromBlock,omitempty"`
+	ToBlock   string          `json:"toBlock,omitempty"`
+	BlockHash string          `json:"blockHash,omitempty"`
+	Address   StringOrSlice   `json:"address,omitempty"`
+	Topics    []StringOrSlice `json:"topics,omitempty"`
+}
+
+// Matches returns true if the log matches the address and topic criteria of the filter. The block range
+// is not considered.
+func (f *LogFilter) Matches(log *Log) bool {
+	if len(f.Address) > 0 && !f.Address.containsFold(log.Address) {
+		return false
+	}
+
+	if len(f.Topics) > len(log.Topics) {
+		return false
+	}
+
+	for idx, topics := range f.Topics {
+		// an empty position is a wildcard
+		if len(topics) > 0 && !topics.containsFold(log.Topics[idx]) {
+			return false
+		}
+	}
+
+	return true
+}
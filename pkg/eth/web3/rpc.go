@@ -8,9 +8,15 @@ import (
 
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/juju/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
+var tracer = otel.Tracer("github.com/41north/tethys/pkg/eth/web3")
+
 type Client struct {
 	rpc          jsonrpc.Client
 	sm           *subManager
@@ -75,7 +81,21 @@ func (c *Client) InvokeRequest(
 	req jsonrpc.Request,
 	resp *jsonrpc.Response,
 ) error {
-	return c.rpc.SendContext(ctx, req, resp)
+	ctx, span := tracer.Start(ctx, "web3.Client.InvokeRequest",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.method", req.Method)),
+	)
+	defer span.End()
+
+	err := c.rpc.SendContext(ctx, req, resp)
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case resp.Error != nil:
+		span.SetStatus(codes.Error, resp.Error.Message)
+	}
+	return err
 }
 
 func (c *Client) BlockNumber(ctx context.Context) (*big.Int, error) {
@@ -152,8 +172,23 @@ func (c *Client) SyncProgress(ctx context.Context) (bool, error) {
 }
 
 func (c *Client) LatestBlock(ctx context.Context) (*Block, error) {
+	return c.BlockByNumber(ctx, "latest")
+}
+
+// BlockByNumber retrieves a block by number or tag e.g. latest, safe or finalized.
+func (c *Client) BlockByNumber(ctx context.Context, numberOrTag string) (*Block, error) {
+	var resp jsonrpc.Response
+	if err := c.Invoke(ctx, "eth_getBlockByNumber", []interface{}{numberOrTag, false}, &resp); err != nil {
+		return nil, err
+	}
+	var result Block
+	err := resp.UnmarshalResult(&result)
+	return &result, err
+}
+
+func (c *Client) BlockByHash(ctx context.Context, hash string) (*Block, error) {
 	var resp jsonrpc.Response
-	if err := c.Invoke(ctx, "eth_getBlockByNumber", []interface{}{"latest", false}, &resp); err != nil {
+	if err := c.Invoke(ctx, "eth_getBlockByHash", []interface{}{hash, false}, &resp); err != nil {
 		return nil, err
 	}
 	var result Block
@@ -79,6 +79,10 @@ func (c *Client) SubscribeToNewHeads(context context.Context) (string, error) {
 	return c.Subscribe(context, []any{"newHeads"})
 }
 
+func (c *Client) SubscribeToLogs(context context.Context, filter LogFilter) (string, error) {
+	return c.Subscribe(context, []any{"logs", filter})
+}
+
 func (c *Client) handleRequest(req *jsonrpc.Request) {
 	if req.Method != "eth_subscription" {
 		log.Errorf("unexpected request received: %v", req)
@@ -83,6 +83,16 @@ func (h *Head) TotalDifficultyBI() (*big.Int, error) {
 	return hexutil.DecodeBig(h.TotalDifficulty)
 }
 
+// BlockRef identifies a block by number and hash, e.g. the safe or finalized block.
+type BlockRef struct {
+	BlockNumber string `json:"blockNumber"`
+	BlockHash   string `json:"blockHash"`
+}
+
+func (r *BlockRef) BlockNumberBI() (*big.Int, error) {
+	return hexutil.DecodeBig(r.BlockNumber)
+}
+
 type SubscriptionNotification struct {
 	SubscriptionId string          `json:"subscription"`
 	Result         json.RawMessage `json:"result"`
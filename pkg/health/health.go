@@ -0,0 +1,34 @@
+package health
+
+import (
+	"net/http"
+)
+
+const (
+	// LivenessPath reports the process is up and serving http.
+	LivenessPath = "/healthz"
+
+	// ReadinessPath reports the process is able to serve requests.
+	ReadinessPath = "/readyz"
+)
+
+// Check returns an error describing why the process is not ready, or nil if it is.
+type Check func() error
+
+// Register adds the liveness and readiness endpoints to the mux. The readiness endpoint responds with a 503 and
+// the reason whilst the check fails.
+func Register(mux *http.ServeMux, ready Check) {
+	mux.HandleFunc(LivenessPath, func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc(ReadinessPath, func(writer http.ResponseWriter, _ *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(writer, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte("ok\n"))
+	})
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// Namespace is the prefix for all tethys metrics.
+	Namespace = "tethys"
+
+	// Path is the http path on which metrics are served.
+	Path = "/metrics"
+)
+
+// Handler serves the metrics from the default registry.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ListenAndServe serves the metrics, along with any other handlers registered on the mux, on the given
+// address until the context is done.
+func ListenAndServe(ctx context.Context, address string, mux *http.ServeMux) error {
+	mux.Handle(Path, Handler())
+
+	srv := &http.Server{Addr: address, Handler: mux}
+
+	g := new(errgroup.Group)
+
+	g.Go(func() error {
+		<-ctx.Done()
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(timeoutCtx)
+	})
+
+	g.Go(func() error {
+		err := srv.ListenAndServe()
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	})
+
+	return g.Wait()
+}
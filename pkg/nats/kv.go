@@ -2,6 +2,7 @@ package nats
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"regexp"
@@ -17,6 +18,11 @@ import (
 	"github.com/juju/errors"
 )
 
+const (
+	// cacheEnvelopeHeaderSize is the size of the expiry time which prefixes values written by the cache adapter.
+	cacheEnvelopeHeaderSize = 8
+)
+
 var sanitizeKeyRegex = regexp.MustCompile(`[^-/_=.a-zA-Z\d]+`)
 
 type KeyValueEntry[T any] interface {
@@ -126,6 +132,9 @@ type KeyValue[T any] interface {
 
 	Put(key string, value T) (uint64, error)
 
+	// Update will update the value iff the latest revision matches.
+	Update(key string, value T, last uint64) (uint64, error)
+
 	Watch(key string, opts ...nats.WatchOpt) (KeyWatcher[T], error)
 
 	WatchAll(opts ...nats.WatchOpt) (KeyWatcher[T], error)
@@ -174,6 +183,14 @@ func (s kv[T]) Put(key string, value T) (uint64, error) {
 	return s.kv.Put(key, bytes)
 }
 
+func (s kv[T]) Update(key string, value T, last uint64) (uint64, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return 0, errors.Annotate(err, "failed to marshal value to json")
+	}
+	return s.kv.Update(key, bytes, last)
+}
+
 func (s kv[T]) Delete(key string) error {
 	return s.kv.Delete(key)
 }
@@ -192,6 +209,9 @@ type CacheEntry struct{}
 
 type kvCacheAdapter struct {
 	kv nats.KeyValue
+	// envelope prefixes values with their expiry time, it must only be enabled for buckets which are written
+	// exclusively through the cache
+	envelope bool
 }
 
 func (c kvCacheAdapter) sanitizeKey(key string) string {
@@ -217,9 +237,11 @@ func (c kvCacheAdapter) MGet(ctx context.Context, keys []string) ([]cache.Value,
 					resultsCh <- async.NewResultErr[*cache.Value](err)
 					continue
 				}
-				value := cache.Value{Valid: entry != nil}
-				if entry != nil {
-					value.Bytes = entry.Value()
+				value := cache.Value{Valid: false}
+				if entry != nil && c.envelope {
+					value.Bytes, value.Valid = openCacheEnvelope(entry.Value())
+				} else if entry != nil {
+					value.Bytes, value.Valid = entry.Value(), true
 				}
 				resultsCh <- async.NewResult[*cache.Value](&value)
 			}
@@ -244,12 +266,15 @@ func (c kvCacheAdapter) MGet(ctx context.Context, keys []string) ([]cache.Value,
 	return values, nil
 }
 
-func (c kvCacheAdapter) MSet(ctx context.Context, keyValues map[string][]byte, _ time.Duration, _ ...cache.MSetOptions) error {
+func (c kvCacheAdapter) MSet(ctx context.Context, keyValues map[string][]byte, ttl time.Duration, _ ...cache.MSetOptions) error {
 	for key, value := range keyValues {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
+			if c.envelope {
+				value = sealCacheEnvelope(value, ttl)
+			}
 			_, err := c.kv.Put(c.sanitizeKey(key), value)
 			if err != nil {
 				return errors.Annotate(err, "failed to write value to kv store")
@@ -274,34 +299,112 @@ func (c kvCacheAdapter) Del(ctx context.Context, keys ...string) error {
 	return nil
 }
 
-func NewCache[V any](
-	localCacheSize int,
-	kv KeyValue[V],
-	ttl time.Duration,
-) cache.Cache {
+// sealCacheEnvelope prefixes the value with its expiry time. The kv bucket has a single TTL for all entries,
+// the envelope allows entries to expire sooner.
+func sealCacheEnvelope(value []byte, ttl time.Duration) []byte {
+	var expiry int64
+	if ttl > 0 {
+		expiry = time.Now().Add(ttl).UnixMilli()
+	}
+	result := make([]byte, cacheEnvelopeHeaderSize, cacheEnvelopeHeaderSize+len(value))
+	binary.BigEndian.PutUint64(result, uint64(expiry))
+	return append(result, value...)
+}
+
+// openCacheEnvelope returns the value within the envelope, or false if it has expired or is malformed.
+func openCacheEnvelope(envelope []byte) ([]byte, bool) {
+	// the most significant byte of the expiry is always zero, which distinguishes an envelope from plain json
+	// written before envelopes were introduced
+	if len(envelope) < cacheEnvelopeHeaderSize || envelope[0] != 0 {
+		return nil, false
+	}
+	expiry := int64(binary.BigEndian.Uint64(envelope))
+	if expiry > 0 && time.Now().UnixMilli() > expiry {
+		return nil, false
+	}
+	return envelope[cacheEnvelopeHeaderSize:], true
+}
+
+// CacheSetting configures a group of cache entries identified by a prefix.
+type CacheSetting struct {
+	Prefix string
+	TTL    time.Duration
+	// LocalOnly prevents entries from being written to the shared kv store.
+	LocalOnly bool
+}
+
+// CacheFactory creates caches backed by a kv store which share the same local cache.
+type CacheFactory struct {
+	factory     cache.Factory
+	sharedCache kvCacheAdapter
+	bucket      string
+}
+
+// NewCacheFactory creates a factory whose caches own the kv store, values are written with an expiry header so
+// that entries can expire sooner than the bucket TTL. The kv store must not be read or written elsewhere.
+func NewCacheFactory[V any](localCacheSize int, kv KeyValue[V]) *CacheFactory {
+	return newCacheFactory(localCacheSize, kv, true)
+}
+
+func newCacheFactory[V any](localCacheSize int, kv KeyValue[V], envelope bool) *CacheFactory {
 	localCache := cache.NewTinyLFU(localCacheSize)
-	sharedCache := kvCacheAdapter{kv: kv.Delegate()}
+	sharedCache := kvCacheAdapter{kv: kv.Delegate(), envelope: envelope}
+	return &CacheFactory{
+		factory:     cache.NewFactory(sharedCache, localCache),
+		sharedCache: sharedCache,
+		bucket:      kv.Delegate().Bucket(),
+	}
+}
+
+// Bucket is the kv bucket backing the caches.
+func (f *CacheFactory) Bucket() string {
+	return f.bucket
+}
 
-	factory := cache.NewFactory(sharedCache, localCache)
-	return factory.NewCache([]cache.Setting{
-		{
-			Prefix: kv.Delegate().Bucket(), // todo what's the correct mapping for this?
+// NewCache creates a cache with the given settings. Prefixes are global and must not be re-used.
+func (f *CacheFactory) NewCache(settings ...CacheSetting) cache.Cache {
+	var cacheSettings []cache.Setting
+	for _, setting := range settings {
+		attributes := map[cache.Type]cache.Attribute{
+			cache.LocalCacheType: {TTL: setting.TTL},
+		}
+
+		cacheSetting := cache.Setting{
+			Prefix: setting.Prefix,
 			MarshalFunc: func(value interface{}) ([]byte, error) {
 				return json.Marshal(value)
 			},
 			UnmarshalFunc: func(bytes []byte, value interface{}) error {
 				return json.Unmarshal(bytes, value)
 			},
-			CacheAttributes: map[cache.Type]cache.Attribute{
-				cache.LocalCacheType:  {TTL: ttl}, // match the overall ttl for now
-				cache.SharedCacheType: {TTL: ttl}, // has no effect, but we set for consistency
-			},
-			MGetter: func(keys ...string) (interface{}, error) {
+			CacheAttributes: attributes,
+		}
+
+		if !setting.LocalOnly {
+			attributes[cache.SharedCacheType] = cache.Attribute{TTL: setting.TTL}
+			cacheSetting.MGetter = func(keys ...string) (interface{}, error) {
 				// set a relatively sane timeout, this may need revised
 				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 				defer cancel()
-				return sharedCache.MGet(ctx, keys)
-			},
-		},
+				return f.sharedCache.MGet(ctx, keys)
+			}
+		}
+
+		cacheSettings = append(cacheSettings, cacheSetting)
+	}
+
+	return f.factory.NewCache(cacheSettings)
+}
+
+// NewCache creates a read-through cache for a kv store which is shared with other writers, values are read
+// and written as plain json.
+func NewCache[V any](
+	localCacheSize int,
+	kv KeyValue[V],
+	ttl time.Duration,
+) cache.Cache {
+	return newCacheFactory(localCacheSize, kv, false).NewCache(CacheSetting{
+		Prefix: kv.Delegate().Bucket(), // todo what's the correct mapping for this?
+		TTL:    ttl,
 	})
 }
@@ -0,0 +1,59 @@
+package nats
+
+import (
+	"github.com/41north/go-jsonrpc"
+	"github.com/41north/tethys/pkg/metrics"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	reconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "nats",
+		Name:      "reconnects_total",
+		Help:      "Number of times the connection to the NATS server has been re-established.",
+	})
+
+	rpcInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "rpc_server",
+		Name:      "in_flight_requests",
+		Help:      "Number of rpc requests awaiting a response from the web3 client.",
+	})
+
+	rpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "rpc_server",
+		Name:      "requests_total",
+		Help:      "Number of rpc requests served from NATS by method and status.",
+	}, []string{"method", "status"})
+
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "rpc_server",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of rpc requests to the web3 client by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+// CountReconnects is a connection option which counts reconnects to the NATS server.
+func CountReconnects() nats.Option {
+	return nats.ReconnectHandler(func(_ *nats.Conn) {
+		reconnects.Inc()
+	})
+}
+
+// RequestStatus summarises the outcome of a request for use as a metric label.
+func RequestStatus(err error, resp *jsonrpc.Response) string {
+	switch {
+	case err != nil:
+		return "error"
+	case resp.Error != nil:
+		return "rpc_error"
+	default:
+		return "ok"
+	}
+}
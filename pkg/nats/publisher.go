@@ -12,6 +12,12 @@ type Publisher[T any] struct {
 	js      nats.JetStreamContext
 }
 
+// WithSubject returns a copy of the publisher which publishes to the given subject instead.
+func (p Publisher[T]) WithSubject(subject string) Publisher[T] {
+	p.Subject = subject
+	return p
+}
+
 func (p Publisher[T]) Publish(payload T, opts ...nats.PubOpt) (*nats.PubAck, error) {
 	bytes, err := json.Marshal(payload)
 	if err != nil {
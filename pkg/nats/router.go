@@ -1,6 +1,7 @@
 package nats
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,14 +10,15 @@ import (
 
 	"github.com/41north/go-jsonrpc"
 
-	log "github.com/sirupsen/logrus"
-	"github.com/viney-shih/go-cache"
-
 	"github.com/juju/errors"
+	"golang.org/x/crypto/sha3"
 )
 
 const (
 	ErrNoClientsAvailable = errors.ConstError("no clients available")
+
+	// DefaultCacheTTL is how long responses are cached when a policy does not specify a TTL.
+	DefaultCacheTTL = 1 * time.Hour
 )
 
 func SubjectName(keys ...string) string {
@@ -32,8 +34,32 @@ func SubjectName(keys ...string) string {
 
 type RouteOpt = func(opts *RouteOpts) error
 
+// CachePolicy controls how the responses for a method are cached.
+type CachePolicy struct {
+	// TTL is how long a response is cached for.
+	TTL time.Duration
+	// LocalOnly prevents responses from being shared with other proxy instances.
+	LocalOnly bool
+	// NonNullOnly prevents null results from being cached, e.g. a receipt for a pending transaction.
+	NonNullOnly bool
+	// FinalizedOnly restricts caching to responses for finalized blocks.
+	FinalizedOnly bool
+}
+
 type RouteOpts struct {
 	Cache bool
+
+	// CachePolicy is applied when caching is enabled.
+	CachePolicy CachePolicy
+
+	// BlockParamIdx is the index of the block parameter within the request params, -1 if there is none.
+	BlockParamIdx int
+
+	// RequiresState indicates the request reads the world state at the requested block, rather than just block data.
+	RequiresState bool
+
+	// Hedge allows a second copy of the request to be sent to another client if the first is slow to answer.
+	Hedge bool
 }
 
 func CacheRoute(cache bool) RouteOpt {
@@ -43,10 +69,59 @@ func CacheRoute(cache bool) RouteOpt {
 	}
 }
 
+// CacheWith enables caching with the given policy.
+func CacheWith(policy CachePolicy) RouteOpt {
+	return func(opts *RouteOpts) error {
+		if policy.TTL <= 0 {
+			policy.TTL = DefaultCacheTTL
+		}
+		opts.Cache = true
+		opts.CachePolicy = policy
+		return nil
+	}
+}
+
+// BlockParam indicates the position of the block parameter within the request params.
+func BlockParam(idx int) RouteOpt {
+	return func(opts *RouteOpts) error {
+		opts.BlockParamIdx = idx
+		return nil
+	}
+}
+
+// RequiresState indicates the request reads the world state at the requested block.
+func RequiresState(requiresState bool) RouteOpt {
+	return func(opts *RouteOpts) error {
+		opts.RequiresState = requiresState
+		return nil
+	}
+}
+
+// Hedge enables hedged requests, which should only be used for reads that are safe to send twice.
+func Hedge(hedge bool) RouteOpt {
+	return func(opts *RouteOpts) error {
+		opts.Hedge = hedge
+		return nil
+	}
+}
+
 func DefaultRouteOpts() RouteOpts {
 	return RouteOpts{
-		Cache: false,
+		Cache:         false,
+		CachePolicy:   CachePolicy{TTL: DefaultCacheTTL},
+		BlockParamIdx: -1,
+	}
+}
+
+// BuildRouteOpts applies the options on top of the defaults.
+func BuildRouteOpts(options ...RouteOpt) (RouteOpts, error) {
+	opts := DefaultRouteOpts()
+	for _, opt := range options {
+		if err := opt(&opts); err != nil {
+			return opts, err
+		}
 	}
+	return opts, nil
 }
 
 type Router interface {
@@ -95,74 +170,22 @@ func NewStaticError(error jsonrpc.Error) Router {
 	return &staticRouter{resp: resp}
 }
 
-type cachingRouter struct {
-	cache       cache.Cache
-	cachePrefix string
-	router      Router
-	log         *log.Entry
+// UnmarshalParams decodes request params, preserving numbers as json.Number so that re-encoding them is lossless.
+func UnmarshalParams(data []byte, params any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(params)
 }
 
-func (r *cachingRouter) Request(req jsonrpc.Request, resp *jsonrpc.Response, timeout time.Duration, options ...RouteOpt) error {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	return r.RequestWithContext(ctx, req, resp, options...)
-}
-
-func (r *cachingRouter) RequestWithContext(ctx context.Context, req jsonrpc.Request, resp *jsonrpc.Response, options ...RouteOpt) error {
-	// build options
-	opts := DefaultRouteOpts()
-	for _, opt := range options {
-		if err := opt(&opts); err != nil {
-			return err
-		}
-	}
-
-	if !opts.Cache {
-		// caching is disabled for this request
-		return r.router.RequestWithContext(ctx, req, resp, options...)
-	}
-
-	// unmarshal params array
-	var params []any
-	err := json.Unmarshal(req.Params, &params)
+// CacheKey builds a fixed length cache key from the method and a keccak hash of the params encoded as
+// canonical json. Object keys are sorted during encoding so equal params always produce the same key,
+// regardless of the order in which they were sent.
+func CacheKey(method string, params any) (string, error) {
+	encoded, err := json.Marshal(params)
 	if err != nil {
-		return errors.Annotate(err, "failed to unmarshal params array")
-	}
-
-	// build cache key
-	// todo this approach will not work well for requests like eth_call that can have large request params
-
-	sb := strings.Builder{}
-	sb.WriteString(req.Method)
-
-	for _, param := range params {
-		// todo implement a more efficient approach to constructing the key
-		sb.WriteString(fmt.Sprintf("_%v", param))
-	}
-
-	//
-	key := sb.String()
-	l := r.log.WithFields(log.Fields{
-		"reqId":     string(req.Id),
-		"reqMethod": req.Method,
-		"cacheKey":  key,
-	})
-	l.Debug("loading from cache")
-	return r.cache.GetByFunc(ctx, r.cachePrefix, key, resp, func() (interface{}, error) {
-		l.Debug("cache miss")
-		err := r.router.RequestWithContext(ctx, req, resp)
-		return resp, err
-	})
-}
-
-func NewCachingRouter(cache cache.Cache, cachePrefix string, router Router) Router {
-	return &cachingRouter{
-		cache:       cache,
-		cachePrefix: cachePrefix,
-		router:      router,
-		log: log.WithFields(log.Fields{
-			"component":   "cachingRouter",
-			"cachePrefix": cachePrefix,
-		}),
+		return "", err
 	}
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(encoded)
+	return fmt.Sprintf("%s_%x", method, hasher.Sum(nil)), nil
 }
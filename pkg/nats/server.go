@@ -12,6 +12,8 @@ import (
 	"github.com/juju/errors"
 	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -173,8 +175,30 @@ func (srv *RpcServer) onRequest(ctx context.Context, msg *nats.Msg) {
 		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
+		// continue the trace from the proxy, if any
+		ctx, span := tracer.Start(ExtractTrace(ctx, msg), "RpcServer.onRequest",
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("rpc.method", request.Method),
+				attribute.String("client.id", srv.Options.ClientId),
+			),
+		)
+		defer span.End()
+
+		rpcInFlight.Inc()
+		defer rpcInFlight.Dec()
+
+		start := time.Now()
+
 		var resp jsonrpc.Response
-		if err := srv.client.InvokeRequest(ctx, request, &resp); err != nil {
+		err := srv.client.InvokeRequest(ctx, request, &resp)
+
+		rpcDuration.WithLabelValues(request.Method).Observe(time.Since(start).Seconds())
+		status := RequestStatus(err, &resp)
+		rpcRequests.WithLabelValues(request.Method, status).Inc()
+		span.SetAttributes(attribute.String("rpc.status", status))
+
+		if err != nil {
 			respondWithError(msg, &request, &jsonrpc.Error{
 				Code:    -32603,
 				Message: "Internal error",
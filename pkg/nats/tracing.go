@@ -0,0 +1,64 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/41north/go-jsonrpc"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/41north/tethys/pkg/nats")
+
+// Request sends a JSON-RPC request to the subject within a span, propagating the trace context in the
+// message headers so that the span can be continued by the server.
+func Request(ctx context.Context, conn *nats.EncodedConn, subject string, req jsonrpc.Request, resp *jsonrpc.Response) error {
+	ctx, span := tracer.Start(ctx, "nats.request",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "nats"),
+			attribute.String("messaging.destination", subject),
+			attribute.String("rpc.method", req.Method),
+		),
+	)
+	defer span.End()
+
+	err := request(ctx, conn, subject, req, resp)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func request(ctx context.Context, conn *nats.EncodedConn, subject string, req jsonrpc.Request, resp *jsonrpc.Response) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return errors.Annotate(err, "failed to marshal request")
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+
+	reply, err := conn.Conn.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(reply.Data, resp)
+}
+
+// ExtractTrace returns a context containing the trace context propagated in the message headers, if any.
+func ExtractTrace(ctx context.Context, msg *nats.Msg) context.Context {
+	if msg.Header == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(msg.Header))
+}
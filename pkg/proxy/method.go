@@ -12,25 +12,47 @@ type MethodOpts struct {
 	routeOpts     []natsutil.RouteOpt
 	beforeRequest RequestTransform
 	afterResponse ResponseTransform
+	scope         Scope
 }
 
+// RouteOpts appends route options, later options take precedence over earlier ones.
 func RouteOpts(routeOpts ...natsutil.RouteOpt) MethodOpt {
 	return func(opts *MethodOpts) error {
-		opts.routeOpts = routeOpts
+		opts.routeOpts = append(opts.routeOpts, routeOpts...)
 		return nil
 	}
 }
 
+// Cache enables caching of responses according to the policy.
+func Cache(policy natsutil.CachePolicy) MethodOpt {
+	return RouteOpts(natsutil.CacheWith(policy))
+}
+
+// Hedged enables hedging of slow requests with a second copy sent to another client.
+func Hedged() MethodOpt {
+	return RouteOpts(natsutil.Hedge(true))
+}
+
+// RequireScope restricts the method to callers which have been granted the scope.
+func RequireScope(scope Scope) MethodOpt {
+	return func(opts *MethodOpts) error {
+		opts.scope = scope
+		return nil
+	}
+}
+
+// BeforeRequest adds a request transform, which is applied after any previously added transforms.
 func BeforeRequest(transform RequestTransform) MethodOpt {
 	return func(opts *MethodOpts) error {
-		opts.beforeRequest = transform
+		opts.beforeRequest = ComposeRequestTransforms(opts.beforeRequest, transform)
 		return nil
 	}
 }
 
+// AfterResponse adds a response transform, which is applied after any previously added transforms.
 func AfterResponse(transform ResponseTransform) MethodOpt {
 	return func(opts *MethodOpts) error {
-		opts.afterResponse = transform
+		opts.afterResponse = ComposeResponseTransforms(opts.afterResponse, transform)
 		return nil
 	}
 }
@@ -39,6 +61,7 @@ func DefaultMethodOpts() MethodOpts {
 	return MethodOpts{
 		// by default no caching
 		routeOpts: []natsutil.RouteOpt{natsutil.CacheRoute(false)},
+		scope:     ScopePublic,
 	}
 }
 
@@ -48,6 +71,7 @@ type Method interface {
 	RouteOpts() []natsutil.RouteOpt
 	BeforeRequest(req jsonrpc.Request) (jsonrpc.Request, error)
 	AfterResponse(resp *jsonrpc.Response) error
+	Scope() Scope
 }
 
 type method struct {
@@ -81,6 +105,10 @@ func (m method) RouteOpts() []natsutil.RouteOpt {
 	return m.opts.routeOpts
 }
 
+func (m method) Scope() Scope {
+	return m.opts.scope
+}
+
 func (m method) BeforeRequest(req jsonrpc.Request) (jsonrpc.Request, error) {
 	if m.opts.beforeRequest == nil {
 		return req, nil
@@ -0,0 +1,45 @@
+package proxy
+
+import "context"
+
+// Scope is the level of access required to invoke a method. Each scope includes the scopes below it.
+type Scope int
+
+const (
+	// ScopePublic methods can be invoked by anyone.
+	ScopePublic Scope = iota
+	// ScopeAdmin methods expose the internals of the proxy and require an admin credential.
+	ScopeAdmin
+)
+
+func (s Scope) String() string {
+	switch s {
+	case ScopePublic:
+		return "public"
+	case ScopeAdmin:
+		return "admin"
+	default:
+		return ""
+	}
+}
+
+// Allows determines if the scope grants access to a method requiring the given scope.
+func (s Scope) Allows(required Scope) bool {
+	return s >= required
+}
+
+type scopeKey struct{}
+
+// WithScope returns a context carrying the scope granted to the caller.
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext returns the scope granted to the caller, defaulting to public.
+func ScopeFromContext(ctx context.Context) Scope {
+	scope, ok := ctx.Value(scopeKey{}).(Scope)
+	if !ok {
+		return ScopePublic
+	}
+	return scope
+}
@@ -11,6 +11,37 @@ type RequestTransform = func(req jsonrpc.Request) (jsonrpc.Request, error)
 
 type ResponseTransform = func(resp *jsonrpc.Response) error
 
+// ComposeRequestTransforms returns a transform which applies each of the transforms in order. Nil transforms are skipped.
+func ComposeRequestTransforms(transforms ...RequestTransform) RequestTransform {
+	return func(req jsonrpc.Request) (jsonrpc.Request, error) {
+		var err error
+		for _, transform := range transforms {
+			if transform == nil {
+				continue
+			}
+			if req, err = transform(req); err != nil {
+				return req, err
+			}
+		}
+		return req, nil
+	}
+}
+
+// ComposeResponseTransforms returns a transform which applies each of the transforms in order. Nil transforms are skipped.
+func ComposeResponseTransforms(transforms ...ResponseTransform) ResponseTransform {
+	return func(resp *jsonrpc.Response) error {
+		for _, transform := range transforms {
+			if transform == nil {
+				continue
+			}
+			if err := transform(resp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 func marshalParamsArray(req *jsonrpc.Request, params []any) error {
 	bytes, err := json.Marshal(params)
 	if err != nil {
@@ -40,3 +71,22 @@ func ReplaceParameterByIndex(position int, valueFn func(current any) (any, error
 		return req, marshalParamsArray(&req, params)
 	}
 }
+
+// DefaultParameterByIndex appends the default value when the params array ends just before the given position,
+// i.e. when an optional trailing parameter has been omitted.
+func DefaultParameterByIndex(position int, value any) RequestTransform {
+	return func(req jsonrpc.Request) (jsonrpc.Request, error) {
+		var params []any
+		if len(req.Params) > 0 {
+			if err := req.UnmarshalParams(&params); err != nil {
+				return req, errors.Annotate(err, "failed to unmarshal params array")
+			}
+		}
+		if len(params) != position {
+			// either the parameter is present or earlier parameters are missing, do nothing
+			return req, nil
+		}
+		params = append(params, value)
+		return req, marshalParamsArray(&req, params)
+	}
+}